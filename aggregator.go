@@ -0,0 +1,124 @@
+package appink8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// maxAggregatedSeries limits how many metric series are aggregated per
+// interval. Metrics of further series are sent as they are, so that a
+// dimension with unbounded values cannot grow the aggregator without end.
+const maxAggregatedSeries = 1000
+
+// metricaggregator sums up metrics per name and dimension set over an
+// interval, and tracks one aggregate metric per series when the interval
+// is over. The dimensions of a series are the properties of its metrics
+// when they are added, so properties added when the aggregate is tracked,
+// such as the Kubernetes properties, are not part of the series.
+type metricaggregator struct {
+	track     func(appinsights.Telemetry)
+	lock      sync.Mutex
+	flushLock sync.Mutex
+	series    map[string]*appinsights.AggregateMetricTelemetry
+}
+
+func newMetricAggregator(track func(appinsights.Telemetry)) *metricaggregator {
+	return &metricaggregator{
+		track:  track,
+		series: make(map[string]*appinsights.AggregateMetricTelemetry),
+	}
+}
+
+// Run tracks the aggregated metrics every interval, and once more when ctx
+// is done. Closing or flushing the channel of the client tracks them too,
+// see flushingChannel.
+func (ma *metricaggregator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ma.flush()
+			return
+		case <-ticker.C:
+			ma.flush()
+		}
+	}
+}
+
+// Add adds the value of t to its series. It returns false when t was not
+// aggregated because there are too many series already.
+func (ma *metricaggregator) Add(t *appinsights.MetricTelemetry) bool {
+	key := seriesKey(t.Name, t.Properties)
+
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+
+	agg, ok := ma.series[key]
+	if !ok {
+		if len(ma.series) >= maxAggregatedSeries {
+			return false
+		}
+
+		agg = appinsights.NewAggregateMetricTelemetry(t.Name)
+		for k, v := range t.Properties {
+			agg.Properties[k] = v
+		}
+		ma.series[key] = agg
+	}
+
+	agg.AddData([]float64{t.Value})
+	return true
+}
+
+// flush tracks the aggregated metrics and starts a new interval. Flushes
+// do not overlap, so that a flush returns only once the aggregates of any
+// flush in progress are tracked as well.
+func (ma *metricaggregator) flush() {
+	ma.flushLock.Lock()
+	defer ma.flushLock.Unlock()
+
+	ma.lock.Lock()
+	series := ma.series
+	ma.series = make(map[string]*appinsights.AggregateMetricTelemetry)
+	ma.lock.Unlock()
+
+	for _, agg := range series {
+		ma.track(agg)
+	}
+}
+
+// flushingChannel tracks the aggregated metrics before the channel it wraps
+// is flushed or closed, so that the usual shutdown of the SDK, closing the
+// channel of the client, does not lose the metrics of the last interval.
+type flushingChannel struct {
+	appinsights.TelemetryChannel
+	metrics *metricaggregator
+}
+
+func (c *flushingChannel) Flush() {
+	c.metrics.flush()
+	c.TelemetryChannel.Flush()
+}
+
+func (c *flushingChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	c.metrics.flush()
+	return c.TelemetryChannel.Close(retryTimeout...)
+}
+
+// seriesKey identifies the series of a metric by its name and dimensions.
+func seriesKey(name string, dimensions map[string]string) string {
+	pairs := make([]string, 0, len(dimensions))
+	for k, v := range dimensions {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return name + "\x00" + strings.Join(pairs, "\x00")
+}
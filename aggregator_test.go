@@ -0,0 +1,194 @@
+package appink8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAggregatorTestMetric(name string, value float64, dimensions map[string]string) *appinsights.MetricTelemetry {
+	t := appinsights.NewMetricTelemetry(name, value)
+	for k, v := range dimensions {
+		t.Properties[k] = v
+	}
+
+	return t
+}
+
+func Test_That_Flush_Tracks_Aggregate_Per_Metric_Name(t *testing.T) {
+	var tracked []appinsights.Telemetry
+	ma := newMetricAggregator(func(t appinsights.Telemetry) {
+		tracked = append(tracked, t)
+	})
+
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		ma.Add(appinsights.NewMetricTelemetry("queue.length", v))
+	}
+	ma.flush()
+
+	assert.Len(t, tracked, 1)
+	agg := tracked[0].(*appinsights.AggregateMetricTelemetry)
+	assert.Equal(t, "queue.length", agg.Name)
+	assert.Equal(t, 8, agg.Count)
+	assert.Equal(t, 40.0, agg.Value)
+	assert.Equal(t, 2.0, agg.Min)
+	assert.Equal(t, 9.0, agg.Max)
+
+	point := agg.TelemetryData().(*contracts.MetricData).Metrics[0]
+	assert.Equal(t, contracts.Aggregation, point.Kind)
+	assert.InDelta(t, 2.0, point.StdDev, 1e-9)
+}
+
+func Test_That_Flush_Tracks_Aggregate_Per_Dimension_Set(t *testing.T) {
+	var tracked []appinsights.Telemetry
+	ma := newMetricAggregator(func(t appinsights.Telemetry) {
+		tracked = append(tracked, t)
+	})
+
+	ma.Add(newAggregatorTestMetric("orders", 1, map[string]string{"Region": "eu"}))
+	ma.Add(newAggregatorTestMetric("orders", 2, map[string]string{"Region": "eu"}))
+	ma.Add(newAggregatorTestMetric("orders", 3, map[string]string{"Region": "us"}))
+	ma.flush()
+
+	assert.Len(t, tracked, 2)
+	sums := make(map[string]float64)
+	for _, item := range tracked {
+		agg := item.(*appinsights.AggregateMetricTelemetry)
+		sums[agg.Properties["Region"]] = agg.Value
+	}
+	assert.Equal(t, map[string]float64{"eu": 3, "us": 3}, sums)
+}
+
+func Test_That_Flush_Starts_New_Interval(t *testing.T) {
+	count := 0
+	ma := newMetricAggregator(func(t appinsights.Telemetry) {
+		count++
+	})
+
+	ma.Add(appinsights.NewMetricTelemetry("orders", 1))
+	ma.flush()
+	ma.flush()
+
+	assert.Equal(t, 1, count)
+}
+
+func Test_That_Add_Rejects_Metrics_Beyond_Series_Limit(t *testing.T) {
+	ma := newMetricAggregator(func(t appinsights.Telemetry) {})
+
+	for i := 0; i < maxAggregatedSeries; i++ {
+		assert.True(t, ma.Add(newAggregatorTestMetric("orders", 1, map[string]string{"ID": fmt.Sprint(i)})))
+	}
+
+	assert.False(t, ma.Add(newAggregatorTestMetric("orders", 1, map[string]string{"ID": "new"})))
+	assert.True(t, ma.Add(newAggregatorTestMetric("orders", 1, map[string]string{"ID": "0"})))
+}
+
+type aggregator_mockChannel struct {
+	appinsights.TelemetryChannel
+	client  *middleware_mockTelemetryClient
+	flushed int
+	closed  int
+}
+
+func (m *aggregator_mockChannel) Flush() {
+	m.flushed = len(m.client.items)
+}
+
+func (m *aggregator_mockChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	m.closed = len(m.client.items)
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+type aggregator_mockTelemetryClient struct {
+	*middleware_mockTelemetryClient
+	channel *aggregator_mockChannel
+}
+
+func (m *aggregator_mockTelemetryClient) Channel() appinsights.TelemetryChannel {
+	return m.channel
+}
+
+func newAggregatorTestClient() (*kubernetesTelemetryClient, *aggregator_mockChannel) {
+	c, m := newProcessorTestClient()
+	channel := &aggregator_mockChannel{client: m}
+	c.TelemetryClient = &aggregator_mockTelemetryClient{middleware_mockTelemetryClient: m, channel: channel}
+	c.metrics = newMetricAggregator(c.Track)
+
+	return c, channel
+}
+
+func Test_That_Closing_Channel_Tracks_Aggregates_First(t *testing.T) {
+	c, channel := newAggregatorTestClient()
+	c.TrackMetric("orders", 1)
+
+	<-c.Channel().Close()
+
+	assert.Equal(t, 1, channel.closed)
+}
+
+func Test_That_Flushing_Channel_Tracks_Aggregates_First(t *testing.T) {
+	c, channel := newAggregatorTestClient()
+	c.TrackMetric("orders", 1)
+
+	c.Channel().Flush()
+
+	assert.Equal(t, 1, channel.flushed)
+}
+
+func Test_That_Run_Flushes_When_Context_Is_Done(t *testing.T) {
+	tracked := make(chan appinsights.Telemetry, 1)
+	ma := newMetricAggregator(func(t appinsights.Telemetry) {
+		tracked <- t
+	})
+	ma.Add(appinsights.NewMetricTelemetry("orders", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ma.Run(ctx, time.Hour)
+
+	assert.Len(t, tracked, 1)
+}
+
+func Test_That_Track_Adds_Kubernetes_Properties_To_Aggregates_Only(t *testing.T) {
+	c, m := newProcessorTestClient()
+	c.metrics = newMetricAggregator(c.Track)
+
+	c.Track(newAggregatorTestMetric("orders", 1, map[string]string{"Region": "eu"}))
+	c.Track(newAggregatorTestMetric("orders", 2, map[string]string{"Region": "eu"}))
+	assert.Len(t, m.items, 0)
+
+	c.metrics.flush()
+
+	assert.Len(t, m.items, 1)
+	agg := m.items[0].(*appinsights.AggregateMetricTelemetry)
+	assert.Equal(t, 2, agg.Count)
+	assert.Equal(t, "eu", agg.Properties["Region"])
+	assert.Equal(t, newSpec().PodName, agg.Properties["Kubernetes.Pod.Name"])
+}
+
+func Test_That_NewTelemetryClient_Aggregates_Metrics_Outside_Kubernetes(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	m := &middleware_mockTelemetryClient{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newTelemetryClient(m, newOptions(
+		WithFileSystemRoot(root),
+		WithContext(ctx),
+		WithMetricAggregation(time.Hour),
+	))
+	c.TrackMetric("orders", 1)
+
+	assert.Len(t, m.items, 0)
+	assert.Equal(t, ErrNotInCluster, EnrichmentError(c))
+}
@@ -0,0 +1,212 @@
+package appink8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const cgroupFileSystemPath = "/sys/fs/cgroup"
+
+// cgroupUnlimited is the smallest memory limit treated as no limit, since
+// cgroup v1 reports a page aligned maximum int64 when no limit is set.
+const cgroupUnlimited = 1 << 62
+
+type cgroupStats struct {
+	MemoryUsage      uint64
+	MemoryLimit      uint64
+	CPUUsage         time.Duration
+	CPUPeriods       uint64
+	ThrottledPeriods uint64
+}
+
+type cgroupreader interface {
+	ReadStats() (*cgroupStats, error)
+}
+
+// cgroupfs reads the resource usage of the current container from the
+// cgroup file system, as mounted into the container, for either cgroup v1
+// or the unified cgroup v2 hierarchy.
+type cgroupfs struct {
+	path string
+}
+
+func newCGroupFS(root string) *cgroupfs {
+	return &cgroupfs{
+		path: filepath.Join(root, cgroupFileSystemPath),
+	}
+}
+
+func (fs *cgroupfs) IsUnified() bool {
+	_, err := os.Stat(filepath.Join(fs.path, "cgroup.controllers"))
+	return err == nil
+}
+
+func (fs *cgroupfs) ReadStats() (*cgroupStats, error) {
+	if fs.IsUnified() {
+		return fs.readV2()
+	}
+
+	return fs.readV1()
+}
+
+func (fs *cgroupfs) readV2() (*cgroupStats, error) {
+	stats := &cgroupStats{}
+
+	usage, err := readCGroupValue(filepath.Join(fs.path, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+	stats.MemoryUsage = usage
+
+	if limit, err := readCGroupValue(filepath.Join(fs.path, "memory.max")); err == nil && limit < cgroupUnlimited {
+		stats.MemoryLimit = limit
+	}
+
+	cpu, err := readCGroupStat(filepath.Join(fs.path, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.CPUUsage = time.Duration(cpu["usage_usec"]) * time.Microsecond
+	stats.CPUPeriods = cpu["nr_periods"]
+	stats.ThrottledPeriods = cpu["nr_throttled"]
+
+	return stats, nil
+}
+
+func (fs *cgroupfs) readV1() (*cgroupStats, error) {
+	stats := &cgroupStats{}
+
+	usage, err := readCGroupValue(filepath.Join(fs.path, "memory", "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	stats.MemoryUsage = usage
+
+	if limit, err := readCGroupValue(filepath.Join(fs.path, "memory", "memory.limit_in_bytes")); err == nil && limit < cgroupUnlimited {
+		stats.MemoryLimit = limit
+	}
+
+	cpuUsage, err := readCGroupValue(filepath.Join(fs.path, "cpuacct", "cpuacct.usage"))
+	if err != nil {
+		return nil, err
+	}
+	stats.CPUUsage = time.Duration(cpuUsage)
+
+	if cpu, err := readCGroupStat(filepath.Join(fs.path, "cpu", "cpu.stat")); err == nil {
+		stats.CPUPeriods = cpu["nr_periods"]
+		stats.ThrottledPeriods = cpu["nr_throttled"]
+	}
+
+	return stats, nil
+}
+
+// readCGroupValue reads a file with a single value. The value "max" is
+// read as no limit.
+func readCGroupValue(path string) (uint64, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not read cgroup file: %w", err)
+	}
+
+	value := strings.TrimSpace(string(raw))
+	if value == "max" {
+		return cgroupUnlimited, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readCGroupStat reads a file with one key and value per line, such as
+// cpu.stat.
+func readCGroupStat(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cgroup file: %w", err)
+	}
+	defer f.Close()
+
+	stats := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stats[fields[0]] = v
+		}
+	}
+
+	return stats, scanner.Err()
+}
+
+// resourcecollector periodically tracks the memory and CPU usage of the
+// current container as metrics. CPU usage is tracked in cores, averaged
+// over the collection interval.
+type resourcecollector struct {
+	reader     cgroupreader
+	track      func(appinsights.Telemetry)
+	now        func() time.Time
+	previous   *cgroupStats
+	previousAt time.Time
+}
+
+func newResourceCollector(r cgroupreader, track func(appinsights.Telemetry)) *resourcecollector {
+	return &resourcecollector{
+		reader: r,
+		track:  track,
+		now:    time.Now,
+	}
+}
+
+func (rc *resourcecollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rc.collect()
+		}
+	}
+}
+
+func (rc *resourcecollector) collect() {
+	stats, err := rc.reader.ReadStats()
+	if err != nil {
+		return
+	}
+
+	now := rc.now()
+	rc.track(appinsights.NewMetricTelemetry("Kubernetes.Container.Memory.Usage", float64(stats.MemoryUsage)))
+	if stats.MemoryLimit > 0 {
+		rc.track(appinsights.NewMetricTelemetry("Kubernetes.Container.Memory.Limit", float64(stats.MemoryLimit)))
+	}
+
+	if rc.previous != nil {
+		elapsed := now.Sub(rc.previousAt)
+		if elapsed > 0 && stats.CPUUsage >= rc.previous.CPUUsage {
+			cores := float64(stats.CPUUsage-rc.previous.CPUUsage) / float64(elapsed)
+			rc.track(appinsights.NewMetricTelemetry("Kubernetes.Container.CPU.Usage", cores))
+		}
+		if stats.ThrottledPeriods >= rc.previous.ThrottledPeriods {
+			throttled := stats.ThrottledPeriods - rc.previous.ThrottledPeriods
+			rc.track(appinsights.NewMetricTelemetry("Kubernetes.Container.CPU.ThrottledPeriods", float64(throttled)))
+		}
+	}
+
+	rc.previous = stats
+	rc.previousAt = now
+}
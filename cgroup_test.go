@@ -0,0 +1,137 @@
+package appink8s
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+type cgroup_mockReader struct {
+	stats []*cgroupStats
+}
+
+func (m *cgroup_mockReader) ReadStats() (*cgroupStats, error) {
+	if len(m.stats) == 0 {
+		return nil, errors.New("no stats")
+	}
+
+	stats := m.stats[0]
+	m.stats = m.stats[1:]
+	return stats, nil
+}
+
+func newCGroupTestCollector(r cgroupreader, now *time.Time) (*resourcecollector, map[string]float64) {
+	metrics := make(map[string]float64)
+	rc := newResourceCollector(r, func(t appinsights.Telemetry) {
+		m := t.(*appinsights.MetricTelemetry)
+		metrics[m.Name] = m.Value
+	})
+	rc.now = func() time.Time {
+		return *now
+	}
+
+	return rc, metrics
+}
+
+func Test_That_ReadStats_Reads_CGroup_V2_Files(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cgroup.controllers", "cpu memory")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory.current", "1048576\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory.max", "2097152\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cpu.stat", "usage_usec 1500\nnr_periods 10\nnr_throttled 2\nthrottled_usec 300\n")
+
+	stats, err := newCGroupFS(root).ReadStats()
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1048576), stats.MemoryUsage)
+	assert.Equal(t, uint64(2097152), stats.MemoryLimit)
+	assert.Equal(t, 1500*time.Microsecond, stats.CPUUsage)
+	assert.Equal(t, uint64(10), stats.CPUPeriods)
+	assert.Equal(t, uint64(2), stats.ThrottledPeriods)
+}
+
+func Test_That_ReadStats_Reads_Unlimited_CGroup_V2_Memory_As_No_Limit(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cgroup.controllers", "cpu memory")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory.current", "1048576\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory.max", "max\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cpu.stat", "usage_usec 1500\n")
+
+	stats, err := newCGroupFS(root).ReadStats()
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), stats.MemoryLimit)
+}
+
+func Test_That_ReadStats_Reads_CGroup_V1_Files(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory/memory.usage_in_bytes", "1048576\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/memory/memory.limit_in_bytes", "9223372036854771712\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cpuacct/cpuacct.usage", "2000000\n")
+	writeOptionsTestFile(t, root, "/sys/fs/cgroup/cpu/cpu.stat", "nr_periods 10\nnr_throttled 3\nthrottled_time 500\n")
+
+	stats, err := newCGroupFS(root).ReadStats()
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1048576), stats.MemoryUsage)
+	assert.Equal(t, uint64(0), stats.MemoryLimit)
+	assert.Equal(t, 2*time.Millisecond, stats.CPUUsage)
+	assert.Equal(t, uint64(3), stats.ThrottledPeriods)
+}
+
+func Test_That_ReadStats_Returns_Error_Without_CGroup_Files(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+
+	_, err := newCGroupFS(root).ReadStats()
+
+	assert.Error(t, err)
+}
+
+func Test_That_Collect_Tracks_Memory_Only_On_First_Read(t *testing.T) {
+	now := time.Unix(0, 0)
+	rc, metrics := newCGroupTestCollector(&cgroup_mockReader{
+		stats: []*cgroupStats{{MemoryUsage: 100, MemoryLimit: 200}},
+	}, &now)
+
+	rc.collect()
+
+	assert.Equal(t, map[string]float64{
+		"Kubernetes.Container.Memory.Usage": 100,
+		"Kubernetes.Container.Memory.Limit": 200,
+	}, metrics)
+}
+
+func Test_That_Collect_Tracks_CPU_Usage_And_Throttling_Since_Last_Read(t *testing.T) {
+	now := time.Unix(0, 0)
+	rc, metrics := newCGroupTestCollector(&cgroup_mockReader{
+		stats: []*cgroupStats{
+			{MemoryUsage: 100, CPUUsage: time.Second, ThrottledPeriods: 4},
+			{MemoryUsage: 100, CPUUsage: 6 * time.Second, ThrottledPeriods: 7},
+		},
+	}, &now)
+
+	rc.collect()
+	now = now.Add(10 * time.Second)
+	rc.collect()
+
+	assert.Equal(t, 0.5, metrics["Kubernetes.Container.CPU.Usage"])
+	assert.Equal(t, float64(3), metrics["Kubernetes.Container.CPU.ThrottledPeriods"])
+	assert.NotContains(t, metrics, "Kubernetes.Container.Memory.Limit")
+}
+
+func Test_That_Collect_Skips_Failed_Reads(t *testing.T) {
+	now := time.Unix(0, 0)
+	rc, metrics := newCGroupTestCollector(&cgroup_mockReader{}, &now)
+
+	rc.collect()
+
+	assert.Empty(t, metrics)
+}
@@ -5,15 +5,34 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
 )
 
 const k8sHostAddress = "https://kubernetes.default.svc"
-const k8sNodeURI = "api/v1/nodes"
+const k8sServiceHostEnvironmentVariable = "KUBERNETES_SERVICE_HOST"
+const k8sServicePortEnvironmentVariable = "KUBERNETES_SERVICE_PORT"
+const k8sNodeURI = "api/v1/nodes/%s"
 const k8sPodURI = "api/v1/namespaces/%s/pods"
+const k8sAllPodsURI = "api/v1/pods"
+const k8sServiceURI = "api/v1/namespaces/%s/services/%s"
+const k8sEventURI = "api/v1/namespaces/%s/events"
+const watchTimeoutSeconds = 300
+const defaultPageSize = 100
+
+// The partial metadata media types fall back to plain JSON for API
+// servers that do not support them.
+const acceptJSON = "application/json"
+const acceptPartialObjectMetadata = "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1,application/json"
+const acceptPartialObjectMetadataList = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json"
 
 type httpclient interface {
 	Do(*http.Request) (*http.Response, error)
@@ -22,9 +41,44 @@ type httpclient interface {
 type k8sclient struct {
 	httpclient
 	*k8sconfig
+	host     string
+	timeout  time.Duration
+	nodeName string
+	podIP    string
+	pageSize int
+	limiter  *ratelimiter
+	tracker  func(appinsights.Telemetry)
 }
 
-func newK8sClient(cfg *k8sconfig) (*k8sclient, error) {
+func newK8sClient(cfg *k8sconfig, o *options) (*k8sclient, error) {
+	c, err := newHTTPClient(cfg, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &k8sclient{
+		httpclient: c,
+		k8sconfig:  cfg,
+		host:       o.host,
+		timeout:    o.requestTimeout,
+		nodeName:   o.nodeName,
+		podIP:      o.podIP,
+		pageSize:   o.pageSize,
+		limiter:    o.limiter,
+	}, nil
+}
+
+func newHTTPClient(cfg *k8sconfig, o *options) (httpclient, error) {
+	if o.httpClient != nil {
+		return o.httpClient, nil
+	}
+
+	if o.roundTripper != nil {
+		return &http.Client{
+			Transport: o.roundTripper,
+		}, nil
+	}
+
 	ca, err := cfg.CertPool()
 	if err != nil {
 		return nil, err
@@ -38,14 +92,39 @@ func newK8sClient(cfg *k8sconfig) (*k8sclient, error) {
 		TLSClientConfig: tls,
 	}
 
-	c := &http.Client{
+	return &http.Client{
 		Transport: tr,
+	}, nil
+}
+
+// inClusterHostAddress returns the API server address from the service
+// environment variables injected into every pod, which unlike the DNS name
+// works with custom DNS policies and cluster domains. It falls back to the
+// DNS name when the variables are missing.
+func inClusterHostAddress() string {
+	host := os.Getenv(k8sServiceHostEnvironmentVariable)
+	port := os.Getenv(k8sServicePortEnvironmentVariable)
+	if host == "" || port == "" {
+		return k8sHostAddress
 	}
 
-	return &k8sclient{
-		httpclient: c,
-		k8sconfig:  cfg,
-	}, nil
+	return fmt.Sprintf("https://%s", net.JoinHostPort(host, port))
+}
+
+func (c *k8sclient) HostAddress() string {
+	if c.host == "" {
+		return k8sHostAddress
+	}
+
+	return strings.TrimSuffix(c.host, "/")
+}
+
+func (c *k8sclient) RequestTimeout() time.Duration {
+	if c.timeout <= 0 {
+		return defaultRequestTimeout
+	}
+
+	return c.timeout
 }
 
 func (c *k8sclient) PodListURI() (*url.URL, error) {
@@ -54,90 +133,419 @@ func (c *k8sclient) PodListURI() (*url.URL, error) {
 		return nil, err
 	}
 
-	path := fmt.Sprintf(k8sPodURI, namespace)
-	u := fmt.Sprintf("%s/%s", k8sHostAddress, path)
+	return c.NamespacePodListURI(namespace)
+}
+
+func (c *k8sclient) NamespacePodListURI(namespace string) (*url.URL, error) {
+	path := fmt.Sprintf(k8sPodURI, url.PathEscape(namespace))
+	u := fmt.Sprintf("%s/%s", c.HostAddress(), path)
+	return url.Parse(u)
+}
+
+// PodIndexURI returns the URI of the pods in namespace, or of all pods in
+// the cluster for an empty namespace.
+func (c *k8sclient) PodIndexURI(namespace string) (*url.URL, error) {
+	if namespace != "" {
+		return c.NamespacePodListURI(namespace)
+	}
+
+	u := fmt.Sprintf("%s/%s", c.HostAddress(), k8sAllPodsURI)
+	return url.Parse(u)
+}
+
+func (c *k8sclient) ServiceURI(namespace, name string) (*url.URL, error) {
+	path := fmt.Sprintf(k8sServiceURI, url.PathEscape(namespace), url.PathEscape(name))
+	u := fmt.Sprintf("%s/%s", c.HostAddress(), path)
 	return url.Parse(u)
 }
 
-func (c *k8sclient) NodeListURI() (*url.URL, error) {
-	u := fmt.Sprintf("%s/%s", k8sHostAddress, k8sNodeURI)
+func (c *k8sclient) NodeURI(name string) (*url.URL, error) {
+	path := fmt.Sprintf(k8sNodeURI, url.PathEscape(name))
+	u := fmt.Sprintf("%s/%s", c.HostAddress(), path)
 	return url.Parse(u)
 }
 
-func (c *k8sclient) GetPods() (*podListSpec, error) {
+// PodFieldSelector narrows pod listings down to the current pod IP or
+// node, when either is known, to keep responses small in large namespaces.
+func (c *k8sclient) PodFieldSelector() string {
+	if c.podIP != "" {
+		return fmt.Sprintf("status.podIP=%s", c.podIP)
+	}
+	if c.nodeName != "" {
+		return fmt.Sprintf("spec.nodeName=%s", c.nodeName)
+	}
+
+	return ""
+}
+
+func (c *k8sclient) PageSize() int {
+	if c.pageSize <= 0 {
+		return defaultPageSize
+	}
+
+	return c.pageSize
+}
+
+// EachPod calls f with the pods of the current namespace, narrowed down by
+// PodFieldSelector, until f returns false. Pods are requested page by page,
+// so that only one page is held in memory at a time.
+func (c *k8sclient) EachPod(f func(podSpec) bool) error {
+	q := url.Values{}
+	if selector := c.PodFieldSelector(); selector != "" {
+		q.Set("fieldSelector", selector)
+	}
+
 	u, err := c.PodListURI()
+	if err != nil {
+		return fmt.Errorf("error parsing pod list URI: %w", err)
+	}
+
+	return c.listPodPages(u, q, acceptJSON, func(page *podListSpec) bool {
+		for _, pod := range page.List {
+			if !f(pod) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// GetNamespacePodMetadata lists the metadata of the pods in namespace
+// matching labelSelector. Only metadata is requested, which leaves out the
+// spec and status of every pod from the response.
+func (c *k8sclient) GetNamespacePodMetadata(namespace, labelSelector string) (*podListSpec, error) {
+	u, err := c.NamespacePodListURI(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing pod list URI: %w", err)
 	}
 
-	b, err := c.request(u)
+	q := url.Values{}
+	if labelSelector != "" {
+		q.Set("labelSelector", labelSelector)
+	}
+
+	return c.listPods(u, q, acceptPartialObjectMetadataList)
+}
+
+// ListPods lists the pods in namespace, or all pods in the cluster for an
+// empty namespace. The resource version of the list can be used to watch
+// the pods for changes with WatchPods.
+func (c *k8sclient) ListPods(namespace string) (*podListSpec, error) {
+	u, err := c.PodIndexURI(namespace)
 	if err != nil {
-		return nil, fmt.Errorf("error reading pod list spec: %w", err)
+		return nil, fmt.Errorf("error parsing pod list URI: %w", err)
 	}
 
-	var specs podListSpec
-	if err = json.Unmarshal(b, &specs); err != nil {
-		return nil, fmt.Errorf("error parsing pod list spec: %w", err)
+	return c.listPods(u, url.Values{}, acceptJSON)
+}
+
+func (c *k8sclient) listPods(u *url.URL, q url.Values, accept string) (*podListSpec, error) {
+	specs := &podListSpec{}
+	err := c.listPodPages(u, q, accept, func(page *podListSpec) bool {
+		specs.List = append(specs.List, page.List...)
+		specs.MetaData.ResourceVersion = page.MetaData.ResourceVersion
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &specs, nil
+	return specs, nil
+}
+
+// listPodPages requests the pod list of u page by page, and calls onPage
+// with every page until it returns false or the list is complete.
+func (c *k8sclient) listPodPages(u *url.URL, q url.Values, accept string, onPage func(*podListSpec) bool) error {
+	q.Set("limit", strconv.Itoa(c.PageSize()))
+
+	for {
+		u.RawQuery = q.Encode()
+
+		var page podListSpec
+		if err := c.request(u, accept, &page); err != nil {
+			return fmt.Errorf("error reading pod list spec: %w", err)
+		}
+
+		if !onPage(&page) || page.MetaData.Continue == "" {
+			return nil
+		}
+
+		q.Set("continue", page.MetaData.Continue)
+	}
 }
 
-func (c *k8sclient) GetNodes() (*nodeListSpec, error) {
-	u, err := c.NodeListURI()
+func (c *k8sclient) GetNode(name string) (*nodeSpec, error) {
+	u, err := c.NodeURI(name)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing node list URI: %w", err)
+		return nil, fmt.Errorf("error parsing node URI: %w", err)
+	}
+
+	var spec nodeSpec
+	if err := c.request(u, acceptPartialObjectMetadata, &spec); err != nil {
+		return nil, fmt.Errorf("error reading node spec: %w", err)
 	}
 
-	b, err := c.request(u)
+	return &spec, nil
+}
+
+func (c *k8sclient) GetService(namespace, name string) (*serviceSpec, error) {
+	u, err := c.ServiceURI(namespace, name)
 	if err != nil {
-		return nil, fmt.Errorf("error reading node list spec: %w", err)
+		return nil, fmt.Errorf("error parsing service URI: %w", err)
 	}
 
-	var specs nodeListSpec
-	if err = json.Unmarshal(b, &specs); err != nil {
-		return nil, fmt.Errorf("error parsing node list spec: %w", err)
+	var spec serviceSpec
+	if err := c.request(u, acceptJSON, &spec); err != nil {
+		return nil, fmt.Errorf("error reading service spec: %w", err)
 	}
 
-	return &specs, nil
+	return &spec, nil
 }
 
-func (c *k8sclient) request(u *url.URL) ([]byte, error) {
-	token, err := c.Token()
+// request decodes the JSON response of u into v while it is read, rather
+// than buffering the whole response. Fields not present in v, such as
+// managedFields, are skipped by the decoder without being kept in memory.
+func (c *k8sclient) request(u *url.URL, accept string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.RequestTimeout())
+	defer cancel()
+
+	resp, err := c.send(ctx, u, accept)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &DecodeError{Err: err}
+	}
+
+	return nil
+}
+
+// send requests u and returns the response on success. A rejected token is
+// read again and the request retried once, and error status codes are
+// returned as *APIStatusError.
+func (c *k8sclient) send(ctx context.Context, u *url.URL, accept string) (*http.Response, error) {
+	resp, err := c.do(ctx, u, accept)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		c.InvalidateToken()
+
+		resp, err = c.do(ctx, u, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, newAPIStatusError(resp)
+	}
+
+	return resp, nil
+}
+
+func (c *k8sclient) EventListURI() (*url.URL, error) {
+	namespace, err := c.CurrentNamespace()
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("accept", "application/json")
-	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", token))
+	path := fmt.Sprintf(k8sEventURI, namespace)
+	u := fmt.Sprintf("%s/%s", c.HostAddress(), path)
+	return url.Parse(u)
+}
+
+// WatchPodEvents streams the events about the pod with the given UID,
+// starting after resourceVersion, until the watch is closed by the server
+// or ctx is done.
+func (c *k8sclient) WatchPodEvents(ctx context.Context, podUID, resourceVersion string, onEvent func(string, eventSpec)) error {
+	u, err := c.EventListURI()
+	if err != nil {
+		return fmt.Errorf("error parsing event list URI: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("fieldSelector", fmt.Sprintf("involvedObject.uid=%s", podUID))
+	if resourceVersion != "" {
+		q.Set("resourceVersion", resourceVersion)
+	}
+	u.RawQuery = q.Encode()
+
+	return c.watch(ctx, u, func(ev watchEventSpec) error {
+		var spec eventSpec
+		if err := json.Unmarshal(ev.Object, &spec); err != nil {
+			return &DecodeError{Err: err}
+		}
 
+		onEvent(ev.Type, spec)
+		return nil
+	})
+}
+
+// WatchPods streams the changes to the pods in namespace, or to all pods
+// in the cluster for an empty namespace, starting after resourceVersion.
+func (c *k8sclient) WatchPods(ctx context.Context, namespace, resourceVersion string, onEvent func(string, podSpec)) error {
+	u, err := c.PodIndexURI(namespace)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create request URI: %w", err)
+		return fmt.Errorf("error parsing pod list URI: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if resourceVersion != "" {
+		q := u.Query()
+		q.Set("resourceVersion", resourceVersion)
+		u.RawQuery = q.Encode()
+	}
 
-	resp, err := c.Do(req.WithContext(ctx))
+	return c.watch(ctx, u, func(ev watchEventSpec) error {
+		var spec podSpec
+		if err := json.Unmarshal(ev.Object, &spec); err != nil {
+			return &DecodeError{Err: err}
+		}
+
+		onEvent(ev.Type, spec)
+		return nil
+	})
+}
+
+// watch streams the watch events of u to onEvent as they arrive. Watch
+// errors sent by the server, such as an expired resource version, are
+// returned as *APIStatusError.
+func (c *k8sclient) watch(ctx context.Context, u *url.URL, onEvent func(watchEventSpec) error) error {
+	q := u.Query()
+	q.Set("watch", "true")
+	q.Set("timeoutSeconds", strconv.Itoa(watchTimeoutSeconds))
+	u.RawQuery = q.Encode()
+
+	resp, err := c.send(ctx, u, acceptJSON)
 	if err != nil {
-		return nil, fmt.Errorf("unable to request Kubernetes: %v", err)
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("unable to read Kubernetes API, received status code: %d", resp.StatusCode)
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev watchEventSpec
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return &DecodeError{Err: err}
+		}
+
+		if ev.Type == "ERROR" {
+			e := &APIStatusError{}
+			json.Unmarshal(ev.Object, &e.Status)
+			e.StatusCode = e.Status.Code
+			return e
+		}
+
+		if err := onEvent(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func newAPIStatusError(resp *http.Response) *APIStatusError {
+	e := &APIStatusError{
+		StatusCode: resp.StatusCode,
+	}
+
+	// The body is only a Status object for errors from the API server
+	// itself, so it is decoded on a best-effort basis.
+	json.NewDecoder(resp.Body).Decode(&e.Status)
+
+	return e
+}
+
+func (c *k8sclient) do(ctx context.Context, u *url.URL, accept string) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, &RequestError{URL: u.String(), Err: err}
+		}
+	}
+
+	token, err := c.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request URI: %w", err)
+	}
+
+	req.Header.Add("accept", accept)
+	if token != "" {
+		req.Header.Add("authorization", fmt.Sprintf("Bearer %s", token))
 	}
 
-	b, err := ioutil.ReadAll(resp.Body)
+	start := time.Now()
+	resp, err := c.Do(req.WithContext(ctx))
+	c.track(req, resp, err, time.Since(start))
+
 	if err != nil {
-		return nil, fmt.Errorf("unable to read Kubernetes data: %v", err)
+		return nil, &RequestError{URL: u.String(), Err: err}
+	}
+
+	return resp, nil
+}
+
+const k8sDependencyType = "Kubernetes API"
+
+func (c *k8sclient) track(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+	if c.tracker == nil {
+		return
+	}
+
+	verb, resource := apiVerbAndResource(req.URL)
+	t := appinsights.NewRemoteDependencyTelemetry(fmt.Sprintf("%s %s", req.Method, req.URL.Path), k8sDependencyType, req.URL.Host, err == nil && resp.StatusCode < 400)
+	t.Data = req.URL.String()
+	t.Duration = duration
+	t.Properties["Kubernetes.API.Verb"] = verb
+	t.Properties["Kubernetes.API.Resource"] = resource
+	if resp != nil {
+		t.ResultCode = strconv.Itoa(resp.StatusCode)
+	}
+
+	c.tracker(t)
+}
+
+// apiVerbAndResource returns the Kubernetes API verb and resource of a
+// request URL, e.g. list and pods for /api/v1/namespaces/default/pods.
+func apiVerbAndResource(u *url.URL) (string, string) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	}
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		segments = segments[2:]
+	}
+	if len(segments) == 0 || segments[0] == "" {
+		return "get", ""
+	}
+
+	if u.Query().Get("watch") == "true" {
+		return "watch", segments[0]
+	}
+	if len(segments) > 1 {
+		return "get", segments[0]
 	}
 
-	return b, nil
+	return "list", segments[0]
 }
@@ -2,12 +2,17 @@ package appink8s
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"testing"
 
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,6 +27,43 @@ func (m *client_mockHTTPClient) Do(r *http.Request) (*http.Response, error) {
 	return m.response, m.err
 }
 
+type client_mockSequenceHTTPClient struct {
+	requests  []*http.Request
+	responses []*http.Response
+}
+
+func (m *client_mockSequenceHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, r)
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func Test_That_InClusterHostAddress_Uses_Service_Environment_Variables(t *testing.T) {
+	os.Setenv(k8sServiceHostEnvironmentVariable, "10.0.0.1")
+	os.Setenv(k8sServicePortEnvironmentVariable, "443")
+	defer os.Unsetenv(k8sServiceHostEnvironmentVariable)
+	defer os.Unsetenv(k8sServicePortEnvironmentVariable)
+
+	assert.Equal(t, "https://10.0.0.1:443", inClusterHostAddress())
+}
+
+func Test_That_InClusterHostAddress_Brackets_IPv6_Hosts(t *testing.T) {
+	os.Setenv(k8sServiceHostEnvironmentVariable, "fd00::1")
+	os.Setenv(k8sServicePortEnvironmentVariable, "6443")
+	defer os.Unsetenv(k8sServiceHostEnvironmentVariable)
+	defer os.Unsetenv(k8sServicePortEnvironmentVariable)
+
+	assert.Equal(t, "https://[fd00::1]:6443", inClusterHostAddress())
+}
+
+func Test_That_InClusterHostAddress_Falls_Back_To_DNS_Name(t *testing.T) {
+	os.Unsetenv(k8sServiceHostEnvironmentVariable)
+	os.Unsetenv(k8sServicePortEnvironmentVariable)
+
+	assert.Equal(t, k8sHostAddress, inClusterHostAddress())
+}
+
 func Test_That_PodListURI_Returns_Correct_URI(t *testing.T) {
 	namespace := "default"
 	c := &k8sclient{
@@ -37,19 +79,23 @@ func Test_That_PodListURI_Returns_Correct_URI(t *testing.T) {
 	assert.Equal(t, expected, u.String())
 }
 
-func Test_That_NodeListURI_Returns_Correct_URI(t *testing.T) {
+func Test_That_NodeURI_Returns_Correct_URI(t *testing.T) {
 	c := &k8sclient{
 		k8sconfig: &k8sconfig{},
 	}
 
-	expected := "https://kubernetes.default.svc/api/v1/nodes"
+	expected := "https://kubernetes.default.svc/api/v1/nodes/node-1"
 
-	u, err := c.NodeListURI()
+	u, err := c.NodeURI("node-1")
 	assert.NoError(t, err)
 	assert.Equal(t, expected, u.String())
 }
 
-func Test_That_GetPods_Requests_Correct_URI(t *testing.T) {
+func client_listAllPods(podSpec) bool {
+	return true
+}
+
+func Test_That_EachPod_Requests_Correct_URI(t *testing.T) {
 	namespace := "default"
 	m := &client_mockHTTPClient{
 		response: &http.Response{
@@ -65,14 +111,14 @@ func Test_That_GetPods_Requests_Correct_URI(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetPods()
+	err := c.EachPod(client_listAllPods)
 	assert.NoError(t, err)
 
-	expected, _ := url.Parse(fmt.Sprintf("https://kubernetes.default.svc/api/v1/namespaces/%s/pods", namespace))
+	expected, _ := url.Parse(fmt.Sprintf("https://kubernetes.default.svc/api/v1/namespaces/%s/pods?limit=100", namespace))
 	assert.Equal(t, expected, m.lastRequest.URL)
 }
 
-func Test_That_GetPods_Makes_Valid_Request(t *testing.T) {
+func Test_That_EachPod_Makes_Valid_Request(t *testing.T) {
 	m := &client_mockHTTPClient{
 		response: &http.Response{
 			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
@@ -87,14 +133,14 @@ func Test_That_GetPods_Makes_Valid_Request(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetPods()
+	err := c.EachPod(client_listAllPods)
 	assert.NoError(t, err)
 
 	assert.Equal(t, "GET", m.lastRequest.Method)
 	assert.Equal(t, "application/json", m.lastRequest.Header.Get("accept"))
 }
 
-func Test_That_GetPods_Uses_Bearer_Token_For_Request(t *testing.T) {
+func Test_That_EachPod_Uses_Bearer_Token_For_Request(t *testing.T) {
 	token := "test-token"
 	m := &client_mockHTTPClient{
 		response: &http.Response{
@@ -110,14 +156,14 @@ func Test_That_GetPods_Uses_Bearer_Token_For_Request(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetPods()
+	err := c.EachPod(client_listAllPods)
 	assert.NoError(t, err)
 
 	expected := fmt.Sprintf("Bearer %s", token)
 	assert.Equal(t, expected, m.lastRequest.Header.Get("authorization"))
 }
 
-func Test_That_GetNodes_Requests_Correct_URI(t *testing.T) {
+func Test_That_GetNode_Requests_Correct_URI(t *testing.T) {
 	m := &client_mockHTTPClient{
 		response: &http.Response{
 			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
@@ -132,14 +178,14 @@ func Test_That_GetNodes_Requests_Correct_URI(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetNodes()
+	_, err := c.GetNode("node-1")
 	assert.NoError(t, err)
 
-	expected, _ := url.Parse("https://kubernetes.default.svc/api/v1/nodes")
+	expected, _ := url.Parse("https://kubernetes.default.svc/api/v1/nodes/node-1")
 	assert.Equal(t, expected, m.lastRequest.URL)
 }
 
-func Test_That_GetNodes_Makes_Valid_Request(t *testing.T) {
+func Test_That_GetNode_Makes_Valid_Request(t *testing.T) {
 	m := &client_mockHTTPClient{
 		response: &http.Response{
 			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
@@ -154,14 +200,14 @@ func Test_That_GetNodes_Makes_Valid_Request(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetNodes()
+	_, err := c.GetNode("node-1")
 	assert.NoError(t, err)
 
 	assert.Equal(t, "GET", m.lastRequest.Method)
-	assert.Equal(t, "application/json", m.lastRequest.Header.Get("accept"))
+	assert.Equal(t, acceptPartialObjectMetadata, m.lastRequest.Header.Get("accept"))
 }
 
-func Test_That_GetNodes_Uses_Bearer_Token_For_Request(t *testing.T) {
+func Test_That_GetNode_Uses_Bearer_Token_For_Request(t *testing.T) {
 	token := "test-token"
 	m := &client_mockHTTPClient{
 		response: &http.Response{
@@ -177,9 +223,490 @@ func Test_That_GetNodes_Uses_Bearer_Token_For_Request(t *testing.T) {
 		},
 	}
 
-	_, err := c.GetNodes()
+	_, err := c.GetNode("node-1")
 	assert.NoError(t, err)
 
 	expected := fmt.Sprintf("Bearer %s", token)
 	assert.Equal(t, expected, m.lastRequest.Header.Get("authorization"))
 }
+
+func Test_That_Request_Reads_Token_Again_And_Retries_On_Unauthorized(t *testing.T) {
+	m := &client_mockSequenceHTTPClient{
+		responses: []*http.Response{
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte{})),
+				StatusCode: 401,
+			},
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
+				StatusCode: 200,
+			},
+		},
+	}
+	fr := &config_mockFileReader{
+		token: "expired",
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			namespace:  "default",
+			filereader: fr,
+		},
+	}
+
+	_, err := c.Token()
+	assert.NoError(t, err)
+	fr.token = "rotated"
+
+	err = c.EachPod(client_listAllPods)
+	assert.NoError(t, err)
+
+	assert.Len(t, m.requests, 2)
+	assert.Equal(t, "Bearer expired", m.requests[0].Header.Get("authorization"))
+	assert.Equal(t, "Bearer rotated", m.requests[1].Header.Get("authorization"))
+}
+
+func Test_That_Request_Retries_Unauthorized_Only_Once(t *testing.T) {
+	m := &client_mockSequenceHTTPClient{
+		responses: []*http.Response{
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte{})),
+				StatusCode: 401,
+			},
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte{})),
+				StatusCode: 401,
+			},
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			namespace: "default",
+			filereader: &config_mockFileReader{
+				token: "token",
+			},
+		},
+	}
+
+	err := c.EachPod(client_listAllPods)
+	assert.Error(t, err)
+	assert.Len(t, m.requests, 2)
+}
+
+func Test_That_EachPod_Follows_Continue_Tokens(t *testing.T) {
+	m := &client_mockSequenceHTTPClient{
+		responses: []*http.Response{
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"metadata": {"continue": "next"}, "items": [{"metadata": {"name": "pod-1"}}]}`))),
+				StatusCode: 200,
+			},
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"metadata": {}, "items": [{"metadata": {"name": "pod-2"}}]}`))),
+				StatusCode: 200,
+			},
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+		pageSize: 1,
+	}
+
+	var names []string
+	err := c.EachPod(func(pod podSpec) bool {
+		names = append(names, pod.MetaData.Name)
+		return true
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"pod-1", "pod-2"}, names)
+	assert.Equal(t, "1", m.requests[0].URL.Query().Get("limit"))
+	assert.Equal(t, "", m.requests[0].URL.Query().Get("continue"))
+	assert.Equal(t, "next", m.requests[1].URL.Query().Get("continue"))
+}
+
+func Test_That_EachPod_Stops_Listing_When_Callback_Returns_False(t *testing.T) {
+	m := &client_mockSequenceHTTPClient{
+		responses: []*http.Response{
+			&http.Response{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"metadata": {"continue": "next"}, "items": [{"metadata": {"name": "pod-1"}}, {"metadata": {"name": "pod-2"}}]}`))),
+				StatusCode: 200,
+			},
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+		pageSize: 2,
+	}
+
+	var names []string
+	err := c.EachPod(func(pod podSpec) bool {
+		names = append(names, pod.MetaData.Name)
+		return false
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"pod-1"}, names)
+	assert.Len(t, m.requests, 1)
+}
+
+func Test_That_EachPod_Selects_By_Pod_IP_Before_Node_Name(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+		nodeName: "node-1",
+		podIP:    "10.0.0.5",
+	}
+
+	err := c.EachPod(client_listAllPods)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "status.podIP=10.0.0.5", m.lastRequest.URL.Query().Get("fieldSelector"))
+}
+
+func Test_That_EachPod_Selects_By_Node_Name(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+		nodeName: "node-1",
+	}
+
+	err := c.EachPod(client_listAllPods)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "spec.nodeName=node-1", m.lastRequest.URL.Query().Get("fieldSelector"))
+}
+
+func Test_That_EachPod_Returns_APIStatusError_With_Decoded_Status(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"kind": "Status", "status": "Failure", "message": "pods is forbidden", "reason": "Forbidden", "code": 403}`))),
+			StatusCode: 403,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	err := c.EachPod(client_listAllPods)
+
+	var statusErr *APIStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, "Forbidden", statusErr.Status.Reason)
+	assert.Equal(t, "pods is forbidden", statusErr.Status.Message)
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
+
+func Test_That_EachPod_Returns_DecodeError_On_Invalid_Response(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": [`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	err := c.EachPod(client_listAllPods)
+
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+}
+
+func Test_That_EachPod_Returns_RequestError_On_Transport_Failure(t *testing.T) {
+	m := &client_mockHTTPClient{
+		err: errors.New("connection refused"),
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	err := c.EachPod(client_listAllPods)
+
+	var requestErr *RequestError
+	assert.True(t, errors.As(err, &requestErr))
+}
+
+func Test_That_GetNamespacePodMetadata_Requests_Partial_Object_Metadata(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"kind": "PartialObjectMetadataList", "items": [{"metadata": {"name": "pod-1"}}]}`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	pods, err := c.GetNamespacePodMetadata("default", "app=orders")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "pod-1", pods.List[0].MetaData.Name)
+	assert.Equal(t, acceptPartialObjectMetadataList, m.lastRequest.Header.Get("accept"))
+	assert.Equal(t, "app=orders", m.lastRequest.URL.Query().Get("labelSelector"))
+}
+
+func Test_That_GetNamespacePodMetadata_Lists_Pods_In_Namespace(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"items": []}`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	_, err := c.GetNamespacePodMetadata("shop", "app=orders")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/namespaces/shop/pods", m.lastRequest.URL.Path)
+}
+
+func Test_That_GetService_Reads_Service_Selector(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"kind": "Service", "metadata": {"name": "orders"}, "spec": {"selector": {"app": "orders", "tier": "api"}}}`))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token: "token",
+		},
+	}
+
+	svc, err := c.GetService("shop", "orders")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/namespaces/shop/services/orders", m.lastRequest.URL.Path)
+	assert.Equal(t, "app=orders,tier=api", svc.LabelSelector())
+}
+
+func Benchmark_Decode_Full_Node(b *testing.B) {
+	benchmarkDecodeNode(b, []byte(k8sNodeResponse))
+}
+
+func Benchmark_Decode_Partial_Node_Metadata(b *testing.B) {
+	var full map[string]interface{}
+	if err := json.Unmarshal([]byte(k8sNodeResponse), &full); err != nil {
+		b.Fatal(err)
+	}
+
+	partial, err := json.Marshal(map[string]interface{}{
+		"kind":       "PartialObjectMetadata",
+		"apiVersion": "meta.k8s.io/v1",
+		"metadata":   full["metadata"],
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkDecodeNode(b, partial)
+}
+
+func benchmarkDecodeNode(b *testing.B, payload []byte) {
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var spec nodeSpec
+		if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&spec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_That_APIVerbAndResource_Parses_Request_Paths(t *testing.T) {
+	cases := map[string][2]string{
+		"/api/v1/namespaces/default/pods":              {"list", "pods"},
+		"/api/v1/nodes/node-1":                         {"get", "nodes"},
+		"/api/v1/namespaces/default/events?watch=true": {"watch", "events"},
+		"/apis/apps/v1/namespaces/default/deployments": {"list", "deployments"},
+		"/api/v1/namespaces/default":                   {"get", "namespaces"},
+	}
+
+	for raw, expected := range cases {
+		u, _ := url.Parse(raw)
+		verb, resource := apiVerbAndResource(u)
+
+		assert.Equal(t, expected[0], verb, raw)
+		assert.Equal(t, expected[1], resource, raw)
+	}
+}
+
+func Test_That_Request_Tracks_Dependency_When_Tracker_Is_Set(t *testing.T) {
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"kind": "Status", "code": 403}`))),
+			StatusCode: 403,
+		},
+	}
+
+	var tracked []appinsights.Telemetry
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+		tracker: func(t appinsights.Telemetry) {
+			tracked = append(tracked, t)
+		},
+	}
+
+	_, err := c.GetNode("node-1")
+	assert.Error(t, err)
+
+	assert.Len(t, tracked, 1)
+	dep := tracked[0].(*appinsights.RemoteDependencyTelemetry)
+	assert.Equal(t, "Kubernetes API", dep.Type)
+	assert.Equal(t, "GET /api/v1/nodes/node-1", dep.Name)
+	assert.Equal(t, "kubernetes.default.svc", dep.Target)
+	assert.Equal(t, "403", dep.ResultCode)
+	assert.False(t, dep.Success)
+	assert.Equal(t, "get", dep.Properties["Kubernetes.API.Verb"])
+	assert.Equal(t, "nodes", dep.Properties["Kubernetes.API.Resource"])
+}
+
+func Test_That_WatchPodEvents_Streams_Events_Until_Watch_Error(t *testing.T) {
+	stream := `{"type": "ADDED", "object": {"metadata": {"uid": "1", "resourceVersion": "10"}, "type": "Warning", "reason": "BackOff"}}
+{"type": "MODIFIED", "object": {"metadata": {"uid": "1", "resourceVersion": "11"}, "type": "Warning", "reason": "BackOff", "count": 2}}
+{"type": "ERROR", "object": {"kind": "Status", "reason": "Expired", "code": 410}}
+`
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(stream))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token:     "token",
+			namespace: "default",
+		},
+	}
+
+	var events []eventSpec
+	err := c.WatchPodEvents(context.Background(), "pod-uid", "9", func(kind string, ev eventSpec) {
+		events = append(events, ev)
+	})
+
+	var statusErr *APIStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 410, statusErr.StatusCode)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "11", events[1].MetaData.ResourceVersion)
+
+	q := m.lastRequest.URL.Query()
+	assert.Equal(t, "/api/v1/namespaces/default/events", m.lastRequest.URL.Path)
+	assert.Equal(t, "true", q.Get("watch"))
+	assert.Equal(t, "9", q.Get("resourceVersion"))
+	assert.Equal(t, "involvedObject.uid=pod-uid", q.Get("fieldSelector"))
+}
+
+func Test_That_ListPods_Lists_All_Pods_For_Empty_Namespace(t *testing.T) {
+	m := &client_mockSequenceHTTPClient{
+		responses: []*http.Response{
+			{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"metadata": {"resourceVersion": "5", "continue": "next"}, "items": [{"metadata": {"name": "pod-1"}}]}`))),
+				StatusCode: 200,
+			},
+			{
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"metadata": {"resourceVersion": "5"}, "items": [{"metadata": {"name": "pod-2"}}]}`))),
+				StatusCode: 200,
+			},
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token: "token",
+		},
+	}
+
+	pods, err := c.ListPods("")
+
+	assert.NoError(t, err)
+	assert.Len(t, pods.List, 2)
+	assert.Equal(t, "5", pods.MetaData.ResourceVersion)
+	assert.Equal(t, "/api/v1/pods", m.requests[0].URL.Path)
+	assert.Empty(t, m.requests[0].URL.Query().Get("fieldSelector"))
+}
+
+func Test_That_WatchPods_Streams_Pods_Of_Namespace(t *testing.T) {
+	stream := `{"type": "ADDED", "object": {"metadata": {"name": "pod-1", "resourceVersion": "6"}, "status": {"podIP": "10.1.0.5"}}}
+`
+	m := &client_mockHTTPClient{
+		response: &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(stream))),
+			StatusCode: 200,
+		},
+	}
+	c := &k8sclient{
+		httpclient: m,
+		k8sconfig: &k8sconfig{
+			token: "token",
+		},
+	}
+
+	var pods []podSpec
+	err := c.WatchPods(context.Background(), "shop", "5", func(kind string, pod podSpec) {
+		pods = append(pods, pod)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.0.5", pods[0].Status.PodIP)
+	assert.Equal(t, "/api/v1/namespaces/shop/pods", m.lastRequest.URL.Path)
+	assert.Equal(t, "5", m.lastRequest.URL.Query().Get("resourceVersion"))
+	assert.Equal(t, "true", m.lastRequest.URL.Query().Get("watch"))
+}
@@ -2,27 +2,41 @@ package appink8s
 
 import (
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 )
 
+// tokenExpiryMargin is how long before the expiry of a projected service
+// account token it is read again, to not race the rotation by kubelet.
+const tokenExpiryMargin = 5 * time.Minute
+
 type filereader interface {
 	ReadTokenFile() (string, error)
+	TokenModTime() (time.Time, error)
 	ReadNamespaceFile() (string, error)
 	ReadCertFile() ([]byte, error)
 	ReadContainerID() (string, error)
 }
 
 type k8sconfig struct {
-	token       string
-	namespace   string
-	certificate []byte
+	token        string
+	tokenExpiry  time.Time
+	tokenModTime time.Time
+	tokenLock    sync.Mutex
+	cacheLock    sync.Mutex
+	namespace    string
+	certificate  []byte
 	filereader
 }
 
-func newK8sConfig() *k8sconfig {
+func newK8sConfig(o *options) *k8sconfig {
 	return &k8sconfig{
-		filereader: newK8sFileReader(),
+		filereader: newK8sFileReader(o),
 	}
 }
 
@@ -31,21 +45,80 @@ func (c *k8sconfig) RunningInKubernetes() bool {
 	return err == nil && t != ""
 }
 
+// Token returns the service account token. The token is cached, but read
+// again when the token file has changed or the token is about to expire,
+// since bound service account tokens are rotated by kubelet.
 func (c *k8sconfig) Token() (string, error) {
-	if c.token != "" {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	if c.token != "" && !c.tokenIsStale() {
 		return c.token, nil
 	}
 
+	var modTime time.Time
+	if c.filereader != nil {
+		modTime, _ = c.TokenModTime()
+	}
+
 	token, err := c.ReadTokenFile()
 	if err != nil {
 		return "", fmt.Errorf("error retrieving service account token: %w", err)
 	}
 
 	c.token = token
+	c.tokenExpiry = parseTokenExpiry(token)
+	c.tokenModTime = modTime
 	return c.token, nil
 }
 
+// InvalidateToken forces the token to be read again on the next call to
+// Token, e.g. after the API server rejected it.
+func (c *k8sconfig) InvalidateToken() {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	c.token = ""
+}
+
+func (c *k8sconfig) tokenIsStale() bool {
+	if !c.tokenExpiry.IsZero() && time.Now().Add(tokenExpiryMargin).After(c.tokenExpiry) {
+		return true
+	}
+
+	if c.filereader == nil {
+		return false
+	}
+
+	modTime, err := c.TokenModTime()
+	return err == nil && !modTime.Equal(c.tokenModTime)
+}
+
+func parseTokenExpiry(token string) time.Time {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiry == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Expiry, 0)
+}
+
 func (c *k8sconfig) CurrentNamespace() (string, error) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
 	if c.namespace != "" {
 		return c.namespace, nil
 	}
@@ -60,6 +133,9 @@ func (c *k8sconfig) CurrentNamespace() (string, error) {
 }
 
 func (c *k8sconfig) Certificate() ([]byte, error) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
 	if c.certificate != nil {
 		return c.certificate, nil
 	}
@@ -1,14 +1,19 @@
 package appink8s
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 type config_mockFileReader struct {
 	token             string
+	modTime           time.Time
 	namespace         string
 	cert              []byte
 	container         string
@@ -23,6 +28,10 @@ func (m *config_mockFileReader) ReadTokenFile() (string, error) {
 	return m.token, m.err
 }
 
+func (m *config_mockFileReader) TokenModTime() (time.Time, error) {
+	return m.modTime, m.err
+}
+
 func (m *config_mockFileReader) ReadNamespaceFile() (string, error) {
 	m.callsForNamespace = m.callsForNamespace + 1
 	return m.namespace, m.err
@@ -124,3 +133,108 @@ func Test_That_Certificate_Calls_Into_FileReader_Only_Once(t *testing.T) {
 
 	assert.Equal(t, 1, fr.callsForCertFile)
 }
+
+func Test_That_CurrentNamespace_And_Certificate_Are_Safe_For_Concurrent_Use(t *testing.T) {
+	fr := &config_mockFileReader{
+		namespace: "namespace",
+		cert:      []byte{},
+	}
+	cfg := &k8sconfig{
+		filereader: fr,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cfg.CurrentNamespace()
+			_, _ = cfg.Certificate()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, fr.callsForNamespace)
+	assert.Equal(t, 1, fr.callsForCertFile)
+}
+
+func Test_That_Token_Is_Read_Again_When_File_Changes(t *testing.T) {
+	fr := &config_mockFileReader{
+		token:   "token",
+		modTime: time.Unix(1, 0),
+	}
+	cfg := &k8sconfig{
+		filereader: fr,
+	}
+
+	_, err := cfg.Token()
+	assert.NoError(t, err)
+
+	fr.token = "rotated"
+	fr.modTime = time.Unix(2, 0)
+
+	token, err := cfg.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", token)
+	assert.Equal(t, 2, fr.callsForToken)
+}
+
+func Test_That_Token_Is_Read_Again_When_About_To_Expire(t *testing.T) {
+	fr := &config_mockFileReader{
+		token: newConfigTestToken(time.Now().Add(time.Minute)),
+	}
+	cfg := &k8sconfig{
+		filereader: fr,
+	}
+
+	_, err := cfg.Token()
+	assert.NoError(t, err)
+	_, err = cfg.Token()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, fr.callsForToken)
+}
+
+func Test_That_Token_Is_Cached_Until_Close_To_Expiry(t *testing.T) {
+	fr := &config_mockFileReader{
+		token: newConfigTestToken(time.Now().Add(time.Hour)),
+	}
+	cfg := &k8sconfig{
+		filereader: fr,
+	}
+
+	_, err := cfg.Token()
+	assert.NoError(t, err)
+	_, err = cfg.Token()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, fr.callsForToken)
+}
+
+func Test_That_InvalidateToken_Forces_Token_To_Be_Read_Again(t *testing.T) {
+	fr := &config_mockFileReader{
+		token: "token",
+	}
+	cfg := &k8sconfig{
+		filereader: fr,
+	}
+
+	_, err := cfg.Token()
+	assert.NoError(t, err)
+	cfg.InvalidateToken()
+	_, err = cfg.Token()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, fr.callsForToken)
+}
+
+func Test_That_ParseTokenExpiry_Ignores_Non_JWT_Tokens(t *testing.T) {
+	assert.True(t, parseTokenExpiry("token").IsZero())
+	assert.True(t, parseTokenExpiry("a.b.c").IsZero())
+}
+
+func newConfigTestToken(expiry time.Time) string {
+	claims := fmt.Sprintf(`{"exp":%d}`, expiry.Unix())
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return fmt.Sprintf("header.%s.signature", payload)
+}
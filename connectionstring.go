@@ -0,0 +1,96 @@
+package appink8s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const connectionStringEnvironmentVariable = "APPLICATIONINSIGHTS_CONNECTION_STRING"
+const defaultIngestionEndpoint = "https://dc.services.visualstudio.com"
+const ingestionTrackURI = "v2/track"
+
+// ConnectionString holds the values of an Application Insights
+// connection string.
+type ConnectionString struct {
+	InstrumentationKey string
+	IngestionEndpoint  string
+}
+
+// ParseConnectionString parses a connection string on the form
+// InstrumentationKey=...;IngestionEndpoint=... Keys are case insensitive.
+// When no IngestionEndpoint is given, one is derived from EndpointSuffix
+// and Location, or the global endpoint is used.
+func ParseConnectionString(s string) (*ConnectionString, error) {
+	values := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid connection string segment %q", pair)
+		}
+
+		values[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+
+	iKey := values["instrumentationkey"]
+	if iKey == "" {
+		return nil, errors.New("connection string is missing InstrumentationKey")
+	}
+
+	endpoint := values["ingestionendpoint"]
+	if endpoint == "" && values["endpointsuffix"] != "" {
+		host := fmt.Sprintf("dc.%s", values["endpointsuffix"])
+		if values["location"] != "" {
+			host = fmt.Sprintf("%s.%s", values["location"], host)
+		}
+		endpoint = fmt.Sprintf("https://%s", host)
+	}
+	if endpoint == "" {
+		endpoint = defaultIngestionEndpoint
+	}
+
+	return &ConnectionString{
+		InstrumentationKey: iKey,
+		IngestionEndpoint:  strings.TrimSuffix(endpoint, "/"),
+	}, nil
+}
+
+// TelemetryConfiguration returns a configuration with default batching
+// that submits telemetry to the ingestion endpoint of the connection string.
+func (cs *ConnectionString) TelemetryConfiguration() *appinsights.TelemetryConfiguration {
+	cfg := appinsights.NewTelemetryConfiguration(cs.InstrumentationKey)
+	cfg.EndpointUrl = fmt.Sprintf("%s/%s", cs.IngestionEndpoint, ingestionTrackURI)
+	return cfg
+}
+
+// NewTelemetryClientFromConnectionString creates a telemetry client from
+// an Application Insights connection string.
+func NewTelemetryClientFromConnectionString(connectionString string, opts ...Option) (appinsights.TelemetryClient, error) {
+	cs, err := ParseConnectionString(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTelemetryClientFromConfig(cs.TelemetryConfiguration(), opts...), nil
+}
+
+// NewTelemetryClientFromEnvironment creates a telemetry client from the
+// connection string in the APPLICATIONINSIGHTS_CONNECTION_STRING
+// environment variable.
+func NewTelemetryClientFromEnvironment(opts ...Option) (appinsights.TelemetryClient, error) {
+	s := os.Getenv(connectionStringEnvironmentVariable)
+	if s == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", connectionStringEnvironmentVariable)
+	}
+
+	return NewTelemetryClientFromConnectionString(s, opts...)
+}
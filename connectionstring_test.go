@@ -0,0 +1,84 @@
+package appink8s
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_ParseConnectionString_Reads_Key_And_Endpoint(t *testing.T) {
+	cs, err := ParseConnectionString("InstrumentationKey=key;IngestionEndpoint=https://westeurope-0.in.applicationinsights.azure.com/")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cs.InstrumentationKey)
+	assert.Equal(t, "https://westeurope-0.in.applicationinsights.azure.com", cs.IngestionEndpoint)
+}
+
+func Test_That_ParseConnectionString_Is_Case_Insensitive(t *testing.T) {
+	cs, err := ParseConnectionString("instrumentationkey=key; INGESTIONENDPOINT=http://localhost:8080")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cs.InstrumentationKey)
+	assert.Equal(t, "http://localhost:8080", cs.IngestionEndpoint)
+}
+
+func Test_That_ParseConnectionString_Derives_Endpoint_From_Suffix_And_Location(t *testing.T) {
+	cs, err := ParseConnectionString("InstrumentationKey=key;EndpointSuffix=applicationinsights.azure.cn;Location=chinaeast2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://chinaeast2.dc.applicationinsights.azure.cn", cs.IngestionEndpoint)
+}
+
+func Test_That_ParseConnectionString_Defaults_To_Global_Endpoint(t *testing.T) {
+	cs, err := ParseConnectionString("InstrumentationKey=key")
+
+	assert.NoError(t, err)
+	assert.Equal(t, defaultIngestionEndpoint, cs.IngestionEndpoint)
+}
+
+func Test_That_ParseConnectionString_Fails_Without_Instrumentation_Key(t *testing.T) {
+	_, err := ParseConnectionString("IngestionEndpoint=http://localhost")
+
+	assert.Error(t, err)
+}
+
+func Test_That_ParseConnectionString_Fails_On_Malformed_Segment(t *testing.T) {
+	_, err := ParseConnectionString("InstrumentationKey=key;garbage")
+
+	assert.Error(t, err)
+}
+
+func Test_That_ConnectionString_TelemetryConfiguration_Uses_Track_Endpoint(t *testing.T) {
+	cs := &ConnectionString{
+		InstrumentationKey: "key",
+		IngestionEndpoint:  "http://localhost:8080",
+	}
+
+	cfg := cs.TelemetryConfiguration()
+
+	assert.Equal(t, "key", cfg.InstrumentationKey)
+	assert.Equal(t, "http://localhost:8080/v2/track", cfg.EndpointUrl)
+}
+
+func Test_That_NewTelemetryClientFromEnvironment_Reads_Connection_String(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+
+	os.Setenv(connectionStringEnvironmentVariable, "InstrumentationKey=key;IngestionEndpoint=http://localhost:8080")
+	defer os.Unsetenv(connectionStringEnvironmentVariable)
+
+	c, err := NewTelemetryClientFromEnvironment(WithFileSystemRoot(root))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", c.InstrumentationKey())
+	assert.Equal(t, "http://localhost:8080/v2/track", c.Channel().EndpointAddress())
+}
+
+func Test_That_NewTelemetryClientFromEnvironment_Fails_When_Unset(t *testing.T) {
+	os.Unsetenv(connectionStringEnvironmentVariable)
+
+	_, err := NewTelemetryClientFromEnvironment()
+
+	assert.Error(t, err)
+}
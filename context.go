@@ -0,0 +1,115 @@
+package appink8s
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+type propertiesContextKey struct{}
+type requestPropertiesContextKey struct{}
+
+// WithProperties returns a copy of ctx that carries properties, merged with
+// the properties already on ctx. Telemetry tracked with TrackContext gets
+// these properties, e.g. a tenant or user ID of the current request. Within
+// a request handled by Middleware, the request telemetry gets them too.
+func WithProperties(ctx context.Context, properties map[string]string) context.Context {
+	if rp, ok := ctx.Value(requestPropertiesContextKey{}).(*requestProperties); ok {
+		rp.add(properties)
+	}
+
+	merged := make(map[string]string)
+	for k, v := range PropertiesFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, propertiesContextKey{}, merged)
+}
+
+// PropertiesFromContext returns the properties carried by ctx. The map must
+// not be modified.
+func PropertiesFromContext(ctx context.Context) map[string]string {
+	properties, _ := ctx.Value(propertiesContextKey{}).(map[string]string)
+	return properties
+}
+
+// requestProperties collects the properties attached with WithProperties
+// while a request is handled, since the contexts derived by the handler do
+// not reach back to the middleware.
+type requestProperties struct {
+	lock       sync.Mutex
+	properties map[string]string
+}
+
+func withRequestProperties(ctx context.Context) (context.Context, *requestProperties) {
+	rp := &requestProperties{properties: make(map[string]string)}
+	return context.WithValue(ctx, requestPropertiesContextKey{}, rp), rp
+}
+
+func (rp *requestProperties) add(properties map[string]string) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	for k, v := range properties {
+		rp.properties[k] = v
+	}
+}
+
+func (rp *requestProperties) apply(properties map[string]string) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	for k, v := range rp.properties {
+		properties[k] = v
+	}
+}
+
+// TrackContext tracks t with client, correlated with the operation on ctx
+// and with the properties of ctx. Operation tags and properties already set
+// on t are kept. The Kubernetes properties are added by client as usual.
+func TrackContext(ctx context.Context, client appinsights.TelemetryClient, t appinsights.Telemetry) {
+	applyContext(ctx, t)
+	client.Track(t)
+}
+
+// TrackEventContext tracks an event with the given name like TrackContext.
+func TrackEventContext(ctx context.Context, client appinsights.TelemetryClient, name string) {
+	TrackContext(ctx, client, appinsights.NewEventTelemetry(name))
+}
+
+// TrackTraceContext tracks a trace with the given message and severity like
+// TrackContext.
+func TrackTraceContext(ctx context.Context, client appinsights.TelemetryClient, message string, severity contracts.SeverityLevel) {
+	TrackContext(ctx, client, appinsights.NewTraceTelemetry(message, severity))
+}
+
+// TrackExceptionContext tracks err as an exception like TrackContext.
+func TrackExceptionContext(ctx context.Context, client appinsights.TelemetryClient, err interface{}) {
+	exception := appinsights.NewExceptionTelemetry(err)
+	exception.Frames = appinsights.GetCallstack(2)
+	TrackContext(ctx, client, exception)
+}
+
+func applyContext(ctx context.Context, t appinsights.Telemetry) {
+	if op, ok := OperationFromContext(ctx); ok {
+		tags := make(contracts.ContextTags)
+		op.apply(tags)
+		for k, v := range tags {
+			if _, ok := t.ContextTags()[k]; !ok {
+				t.ContextTags()[k] = v
+			}
+		}
+	}
+
+	properties := t.GetProperties()
+	for k, v := range PropertiesFromContext(ctx) {
+		if _, ok := properties[k]; !ok {
+			properties[k] = v
+		}
+	}
+}
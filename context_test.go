@@ -0,0 +1,65 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_WithProperties_Merges_Properties_Of_Parent_Context(t *testing.T) {
+	parent := WithProperties(context.Background(), map[string]string{"Tenant": "a", "User": "1"})
+	ctx := WithProperties(parent, map[string]string{"User": "2"})
+
+	assert.Equal(t, map[string]string{"Tenant": "a", "User": "1"}, PropertiesFromContext(parent))
+	assert.Equal(t, map[string]string{"Tenant": "a", "User": "2"}, PropertiesFromContext(ctx))
+}
+
+func Test_That_TrackContext_Adds_Operation_And_Properties(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	op := NewOperation("GET /orders")
+	ctx := WithProperties(WithOperation(context.Background(), op), map[string]string{"Tenant": "a"})
+
+	TrackEventContext(ctx, client, "OrderPlaced")
+
+	event := client.items[0].(*appinsights.EventTelemetry)
+	assert.Equal(t, op.ID, event.Tags.Operation().GetId())
+	assert.Equal(t, op.TelemetryID(), event.Tags.Operation().GetParentId())
+	assert.Equal(t, "GET /orders", event.Tags.Operation().GetName())
+	assert.Equal(t, "a", event.Properties["Tenant"])
+}
+
+func Test_That_TrackContext_Keeps_Tags_And_Properties_Of_Telemetry(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	ctx := WithProperties(WithOperation(context.Background(), NewOperation("")), map[string]string{"Tenant": "a"})
+
+	trace := appinsights.NewTraceTelemetry("message", contracts.Information)
+	trace.Tags.Operation().SetId("explicit")
+	trace.Properties["Tenant"] = "b"
+	TrackContext(ctx, client, trace)
+
+	assert.Equal(t, "explicit", trace.Tags.Operation().GetId())
+	assert.Equal(t, "b", trace.Properties["Tenant"])
+}
+
+func Test_That_TrackContext_Adds_Kubernetes_Properties(t *testing.T) {
+	s := newSpec()
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: &mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+		active:      true,
+		initializer: &mockInitializer{spec: s},
+	}
+	ctx := WithProperties(context.Background(), map[string]string{"Tenant": "a"})
+
+	TrackExceptionContext(ctx, c, errors.New("failed"))
+
+	exception := c.TelemetryClient.(*mockTelemetryClient).tracked.(*appinsights.ExceptionTelemetry)
+	assert.Equal(t, "a", exception.Properties["Tenant"])
+	assert.Equal(t, s.PodName, exception.Properties["Kubernetes.Pod.Name"])
+	assert.Contains(t, exception.Frames[0].Method, "Test_That_TrackContext_Adds_Kubernetes_Properties")
+}
@@ -0,0 +1,128 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+var (
+	// ErrNotInCluster is returned when no Kubernetes service account or
+	// kubeconfig could be found.
+	ErrNotInCluster = errors.New("not running in Kubernetes")
+
+	// ErrUnauthorized is matched by API errors with status code 401.
+	ErrUnauthorized = errors.New("unauthorized by the Kubernetes API")
+
+	// ErrForbidden is matched by API errors with status code 403.
+	ErrForbidden = errors.New("forbidden by the Kubernetes API")
+
+	// ErrNotFound is matched by API errors with status code 404.
+	ErrNotFound = errors.New("not found in the Kubernetes API")
+
+	// ErrTimeout is matched by requests that timed out, either on the
+	// client or as reported by the API server.
+	ErrTimeout = errors.New("timeout requesting the Kubernetes API")
+
+	// ErrPodNotFound is returned when no pod matches the current container.
+	ErrPodNotFound = errors.New("no runtime spec could be found")
+
+	// ErrPending is returned while reading the Kubernetes properties is
+	// delayed by WithStartupJitter.
+	ErrPending = errors.New("kubernetes properties are not read yet")
+)
+
+// Status is the Status object returned by the Kubernetes API on failures.
+type Status struct {
+	Kind    string `json:"kind"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Code    int    `json:"code"`
+}
+
+// APIStatusError is returned when the Kubernetes API responds with an
+// error status code.
+type APIStatusError struct {
+	StatusCode int
+	Status     Status
+}
+
+func (e *APIStatusError) Error() string {
+	if e.Status.Message != "" {
+		return fmt.Sprintf("unable to read Kubernetes API, received status code %d: %s", e.StatusCode, e.Status.Message)
+	}
+
+	return fmt.Sprintf("unable to read Kubernetes API, received status code: %d", e.StatusCode)
+}
+
+func (e *APIStatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrTimeout:
+		return e.StatusCode == http.StatusGatewayTimeout || e.Status.Reason == "Timeout"
+	}
+
+	return false
+}
+
+// RequestError is returned when a request to the Kubernetes API could not
+// be completed.
+type RequestError struct {
+	URL string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("unable to request Kubernetes: %v", e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	if target != ErrTimeout {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// DecodeError is returned when a Kubernetes API response could not be
+// parsed.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("unable to parse Kubernetes data: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EnrichmentError returns why client does not add Kubernetes properties to
+// telemetry, or nil if it does. Clients not created by this package, or
+// created outside Kubernetes, return ErrNotInCluster. Clients whose
+// Kubernetes configuration could not be loaded, e.g. from a kubeconfig,
+// return that error.
+func EnrichmentError(client appinsights.TelemetryClient) error {
+	ktc, ok := client.(*kubernetesTelemetryClient)
+	if !ok {
+		return ErrNotInCluster
+	}
+
+	return ktc.Err()
+}
@@ -0,0 +1,68 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_APIStatusError_Matches_Sentinel_For_Status_Code(t *testing.T) {
+	assert.True(t, errors.Is(&APIStatusError{StatusCode: 401}, ErrUnauthorized))
+	assert.True(t, errors.Is(&APIStatusError{StatusCode: 403}, ErrForbidden))
+	assert.True(t, errors.Is(&APIStatusError{StatusCode: 404}, ErrNotFound))
+	assert.True(t, errors.Is(&APIStatusError{StatusCode: 504}, ErrTimeout))
+	assert.False(t, errors.Is(&APIStatusError{StatusCode: 403}, ErrNotFound))
+}
+
+func Test_That_APIStatusError_Matches_Timeout_Reason(t *testing.T) {
+	err := &APIStatusError{
+		StatusCode: 500,
+		Status: Status{
+			Reason: "Timeout",
+		},
+	}
+
+	assert.True(t, errors.Is(err, ErrTimeout))
+}
+
+func Test_That_APIStatusError_Can_Be_Found_In_Wrapped_Error(t *testing.T) {
+	err := fmt.Errorf("error reading pod list spec: %w", &APIStatusError{StatusCode: 403})
+
+	var statusErr *APIStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 403, statusErr.StatusCode)
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
+
+func Test_That_RequestError_Matches_Timeout_On_Deadline(t *testing.T) {
+	err := &RequestError{Err: fmt.Errorf("get: %w", context.DeadlineExceeded)}
+
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_That_RequestError_Does_Not_Match_Timeout_On_Other_Errors(t *testing.T) {
+	err := &RequestError{Err: errors.New("connection refused")}
+
+	assert.False(t, errors.Is(err, ErrTimeout))
+}
+
+func Test_That_EnrichmentError_Returns_ErrNotInCluster_For_Plain_Client(t *testing.T) {
+	err := EnrichmentError(appinsights.NewTelemetryClient("key"))
+
+	assert.True(t, errors.Is(err, ErrNotInCluster))
+}
+
+func Test_That_EnrichmentError_Returns_Initialization_Error(t *testing.T) {
+	c := &kubernetesTelemetryClient{
+		initializer: &mockInitializer{err: &APIStatusError{StatusCode: 403}},
+	}
+
+	err := EnrichmentError(c)
+
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
@@ -0,0 +1,136 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+const minWatchRetryInterval = 5 * time.Second
+const maxWatchRetryInterval = 5 * time.Minute
+
+type eventwatcher interface {
+	WatchPodEvents(ctx context.Context, podUID, resourceVersion string, onEvent func(string, eventSpec)) error
+}
+
+// eventforwarder tracks the Kubernetes events about a pod as traces. Events
+// are keyed by UID and count, so that the events replayed when a watch is
+// restarted are only tracked once.
+type eventforwarder struct {
+	watcher eventwatcher
+	track   func(appinsights.Telemetry)
+	seen    map[string]int
+}
+
+func newEventForwarder(w eventwatcher, track func(appinsights.Telemetry)) *eventforwarder {
+	return &eventforwarder{
+		watcher: w,
+		track:   track,
+		seen:    make(map[string]int),
+	}
+}
+
+// Run watches the events of the pod until ctx is done. The watch is
+// restarted when the server closes it, and retried with an increasing
+// interval on errors.
+func (ef *eventforwarder) Run(ctx context.Context, podUID string) {
+	resourceVersion := ""
+	retry := minWatchRetryInterval
+
+	for ctx.Err() == nil {
+		err := ef.watcher.WatchPodEvents(ctx, podUID, resourceVersion, func(kind string, ev eventSpec) {
+			resourceVersion = ev.MetaData.ResourceVersion
+			retry = minWatchRetryInterval
+			ef.handle(kind, ev)
+		})
+
+		var statusErr *APIStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone {
+			resourceVersion = ""
+			continue
+		}
+		if err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if retry *= 2; retry > maxWatchRetryInterval {
+			retry = maxWatchRetryInterval
+		}
+	}
+}
+
+func (ef *eventforwarder) handle(kind string, ev eventSpec) {
+	key := ev.MetaData.ID
+
+	if kind == "DELETED" {
+		delete(ef.seen, key)
+		return
+	}
+
+	count := ev.Count
+	if count == 0 {
+		count = 1
+	}
+	if seen, ok := ef.seen[key]; ok && seen >= count {
+		return
+	}
+
+	ef.seen[key] = count
+	ef.track(newEventTraceTelemetry(ev))
+}
+
+func newEventTraceTelemetry(ev eventSpec) *appinsights.TraceTelemetry {
+	severity := contracts.Information
+	if ev.Type == "Warning" {
+		severity = contracts.Warning
+	}
+
+	t := appinsights.NewTraceTelemetry(fmt.Sprintf("%s: %s", ev.Reason, ev.Message), severity)
+	if ts := ev.Timestamp(); !ts.IsZero() {
+		t.Timestamp = ts
+	}
+
+	t.Properties["Kubernetes.Event.Name"] = ev.MetaData.Name
+	t.Properties["Kubernetes.Event.Type"] = ev.Type
+	t.Properties["Kubernetes.Event.Reason"] = ev.Reason
+	t.Properties["Kubernetes.Event.Count"] = strconv.Itoa(ev.Count)
+	t.Properties["Kubernetes.Event.Source"] = ev.Source.Component
+	if ev.InvolvedObject.FieldPath != "" {
+		t.Properties["Kubernetes.Event.FieldPath"] = ev.InvolvedObject.FieldPath
+	}
+
+	return t
+}
+
+// newTerminationEventTelemetry describes how the previous instance of the
+// container terminated, e.g. with reason OOMKilled or Error.
+func newTerminationEventTelemetry(spec *runtimeSpec) *appinsights.EventTelemetry {
+	last := spec.LastTermination
+
+	t := appinsights.NewEventTelemetry("Kubernetes.Container.Terminated")
+	t.Properties["Kubernetes.Container.RestartCount"] = strconv.Itoa(spec.RestartCount)
+	t.Properties["Kubernetes.Container.LastTermination.Reason"] = last.Reason
+	t.Properties["Kubernetes.Container.LastTermination.ExitCode"] = strconv.Itoa(last.ExitCode)
+	t.Properties["Kubernetes.Container.LastTermination.Signal"] = strconv.Itoa(last.Signal)
+	if !last.FinishedAt.IsZero() {
+		t.Properties["Kubernetes.Container.LastTermination.FinishedAt"] = last.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	if last.Message != "" {
+		t.Properties["Kubernetes.Container.LastTermination.Message"] = last.Message
+	}
+
+	return t
+}
@@ -0,0 +1,207 @@
+package appink8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+type events_mockWatcher struct {
+	cancel           context.CancelFunc
+	resourceVersions []string
+	calls            []func(func(string, eventSpec)) error
+}
+
+func (m *events_mockWatcher) WatchPodEvents(ctx context.Context, podUID, resourceVersion string, onEvent func(string, eventSpec)) error {
+	m.resourceVersions = append(m.resourceVersions, resourceVersion)
+
+	if len(m.calls) == 0 {
+		m.cancel()
+		return ctx.Err()
+	}
+
+	call := m.calls[0]
+	m.calls = m.calls[1:]
+	return call(onEvent)
+}
+
+func newEventsTestEvent(uid, resourceVersion string, count int) eventSpec {
+	return eventSpec{
+		MetaData: metaDataSpec{
+			ID:              uid,
+			ResourceVersion: resourceVersion,
+		},
+		Type:    "Warning",
+		Reason:  "Unhealthy",
+		Message: "Liveness probe failed",
+		Count:   count,
+	}
+}
+
+func Test_That_NewEventTraceTelemetry_Maps_Warning_Severity(t *testing.T) {
+	ev := newEventsTestEvent("uid", "1", 3)
+	ev.LastTimestamp = time.Unix(100, 0)
+	ev.Source.Component = "kubelet"
+	ev.InvolvedObject.FieldPath = "spec.containers{app}"
+
+	trace := newEventTraceTelemetry(ev)
+
+	assert.Equal(t, contracts.Warning, trace.SeverityLevel)
+	assert.Equal(t, "Unhealthy: Liveness probe failed", trace.Message)
+	assert.Equal(t, time.Unix(100, 0), trace.Timestamp)
+	assert.Equal(t, "Unhealthy", trace.Properties["Kubernetes.Event.Reason"])
+	assert.Equal(t, "3", trace.Properties["Kubernetes.Event.Count"])
+	assert.Equal(t, "kubelet", trace.Properties["Kubernetes.Event.Source"])
+	assert.Equal(t, "spec.containers{app}", trace.Properties["Kubernetes.Event.FieldPath"])
+}
+
+func Test_That_NewEventTraceTelemetry_Maps_Normal_To_Information_Severity(t *testing.T) {
+	ev := newEventsTestEvent("uid", "1", 1)
+	ev.Type = "Normal"
+
+	trace := newEventTraceTelemetry(ev)
+
+	assert.Equal(t, contracts.Information, trace.SeverityLevel)
+}
+
+func Test_That_NewTerminationEventTelemetry_Includes_Last_State(t *testing.T) {
+	spec := &runtimeSpec{
+		RestartCount: 3,
+		LastTermination: &podContainerTerminatedSpec{
+			ExitCode:   143,
+			Signal:     15,
+			Reason:     "Error",
+			FinishedAt: time.Date(2020, 1, 23, 8, 18, 20, 0, time.UTC),
+		},
+	}
+
+	event := newTerminationEventTelemetry(spec)
+
+	assert.Equal(t, "3", event.Properties["Kubernetes.Container.RestartCount"])
+	assert.Equal(t, "Error", event.Properties["Kubernetes.Container.LastTermination.Reason"])
+	assert.Equal(t, "143", event.Properties["Kubernetes.Container.LastTermination.ExitCode"])
+	assert.Equal(t, "15", event.Properties["Kubernetes.Container.LastTermination.Signal"])
+	assert.Equal(t, "2020-01-23T08:18:20Z", event.Properties["Kubernetes.Container.LastTermination.FinishedAt"])
+	assert.NotContains(t, event.Properties, "Kubernetes.Container.LastTermination.Message")
+}
+
+func Test_That_Handle_Tracks_Each_Event_Count_Once(t *testing.T) {
+	var tracked []appinsights.Telemetry
+	ef := newEventForwarder(nil, func(t appinsights.Telemetry) {
+		tracked = append(tracked, t)
+	})
+
+	ef.handle("ADDED", newEventsTestEvent("uid", "1", 1))
+	ef.handle("ADDED", newEventsTestEvent("uid", "1", 1))
+	ef.handle("MODIFIED", newEventsTestEvent("uid", "2", 2))
+
+	assert.Len(t, tracked, 2)
+}
+
+func Test_That_Handle_Skips_Deleted_Events(t *testing.T) {
+	var tracked []appinsights.Telemetry
+	ef := newEventForwarder(nil, func(t appinsights.Telemetry) {
+		tracked = append(tracked, t)
+	})
+
+	ef.handle("ADDED", newEventsTestEvent("uid", "1", 1))
+	ef.handle("DELETED", newEventsTestEvent("uid", "2", 1))
+
+	assert.Len(t, tracked, 1)
+	assert.Empty(t, ef.seen)
+}
+
+func Test_That_Run_Resumes_Watch_From_Last_Resource_Version(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &events_mockWatcher{
+		cancel: cancel,
+		calls: []func(func(string, eventSpec)) error{
+			func(onEvent func(string, eventSpec)) error {
+				onEvent("ADDED", newEventsTestEvent("uid", "5", 1))
+				return nil
+			},
+		},
+	}
+	ef := newEventForwarder(w, func(appinsights.Telemetry) {})
+
+	ef.Run(ctx, "pod-uid")
+
+	assert.Equal(t, []string{"", "5"}, w.resourceVersions)
+}
+
+func Test_That_Run_Restarts_Watch_Without_Resource_Version_When_Gone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &events_mockWatcher{
+		cancel: cancel,
+		calls: []func(func(string, eventSpec)) error{
+			func(onEvent func(string, eventSpec)) error {
+				onEvent("ADDED", newEventsTestEvent("uid", "5", 1))
+				return nil
+			},
+			func(onEvent func(string, eventSpec)) error {
+				return &APIStatusError{StatusCode: 410}
+			},
+		},
+	}
+	ef := newEventForwarder(w, func(appinsights.Telemetry) {})
+
+	ef.Run(ctx, "pod-uid")
+
+	assert.Equal(t, []string{"", "5", ""}, w.resourceVersions)
+}
+
+func Test_That_NewTelemetryClient_Forwards_Events_Without_Other_Telemetry(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestCluster(t, root)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/events"):
+			w.Write([]byte(`{"type": "ADDED", "object": {"metadata": {"uid": "uid", "resourceVersion": "5"}, "type": "Warning", "reason": "Unhealthy", "message": "Liveness probe failed", "count": 1}}` + "\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case strings.Contains(r.URL.Path, "/nodes/"):
+			w.Write([]byte(k8sNodeResponse))
+		default:
+			w.Write([]byte(k8sPodResponse))
+		}
+	}))
+	defer srv.Close()
+	m := &telemetry_mockChannelClient{
+		mockTelemetryClient: mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+		tracked: make(chan appinsights.Telemetry, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newTelemetryClient(m, newOptions(
+		WithFileSystemRoot(root),
+		WithKubernetesHost(srv.URL),
+		WithHTTPClient(srv.Client()),
+		WithContext(ctx),
+		WithEventForwarding(),
+	))
+
+	select {
+	case tracked := <-m.tracked:
+		trace := tracked.(*appinsights.TraceTelemetry)
+		assert.Equal(t, contracts.Warning, trace.SeverityLevel)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was forwarded")
+	}
+}
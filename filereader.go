@@ -4,22 +4,45 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 const k8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 const k8sNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 const k8sCertPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
 
-type k8sfiles struct{}
+type k8sfiles struct {
+	root          string
+	tokenPath     string
+	namespacePath string
+	certPath      string
+	cgroupPath    string
+}
+
+func newK8sFileReader(o *options) *k8sfiles {
+	return &k8sfiles{
+		root:          o.root,
+		tokenPath:     o.tokenPath,
+		namespacePath: o.namespacePath,
+		certPath:      o.certPath,
+		cgroupPath:    o.cgroupPath,
+	}
+}
+
+func (kf *k8sfiles) path(p string) string {
+	if kf.root == "" {
+		return p
+	}
 
-func newK8sFileReader() *k8sfiles {
-	return &k8sfiles{}
+	return filepath.Join(kf.root, p)
 }
 
 func (kf *k8sfiles) ReadTokenFile() (string, error) {
-	token, err := ioutil.ReadFile(k8sTokenPath)
+	token, err := ioutil.ReadFile(kf.path(kf.tokenPath))
 	if err != nil {
 		return "", nil
 	}
@@ -27,8 +50,17 @@ func (kf *k8sfiles) ReadTokenFile() (string, error) {
 	return string(token), nil
 }
 
+func (kf *k8sfiles) TokenModTime() (time.Time, error) {
+	fi, err := os.Stat(kf.path(kf.tokenPath))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
 func (kf *k8sfiles) ReadNamespaceFile() (string, error) {
-	namespace, err := ioutil.ReadFile(k8sNamespacePath)
+	namespace, err := ioutil.ReadFile(kf.path(kf.namespacePath))
 	if err != nil {
 		return "", nil
 	}
@@ -37,11 +69,11 @@ func (kf *k8sfiles) ReadNamespaceFile() (string, error) {
 }
 
 func (kf *k8sfiles) ReadCertFile() ([]byte, error) {
-	return ioutil.ReadFile(k8sCertPath)
+	return ioutil.ReadFile(kf.path(kf.certPath))
 }
 
 func (kf *k8sfiles) ReadContainerID() (string, error) {
-	raw, err := ioutil.ReadFile(k8sContainerInfoPath)
+	raw, err := ioutil.ReadFile(kf.path(kf.cgroupPath))
 	if err != nil {
 		return "", fmt.Errorf("could not read container ID: %w", err)
 	}
@@ -0,0 +1,88 @@
+package appink8s
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const heartbeatMetricName = "HeartbeatState"
+
+// Enrichment states reported by the heartbeat.
+const (
+	enrichmentActive   = "Active"
+	enrichmentPending  = "Pending"
+	enrichmentInactive = "Inactive"
+)
+
+// processStart approximates the start of the process by the time the
+// package was initialized.
+var processStart = time.Now()
+
+// heartbeat periodically tracks a HeartbeatState metric, like the
+// heartbeat of the Application Insights SDKs for other languages. Its
+// value is 0 while the Kubernetes properties are added to telemetry and 1
+// when they could not be read, and its properties describe the pod, the
+// container and the process.
+type heartbeat struct {
+	track func(appinsights.Telemetry)
+	state func() (*runtimeSpec, error)
+	now   func() time.Time
+	start time.Time
+}
+
+func newHeartbeat(track func(appinsights.Telemetry), state func() (*runtimeSpec, error)) *heartbeat {
+	return &heartbeat{
+		track: track,
+		state: state,
+		now:   time.Now,
+		start: processStart,
+	}
+}
+
+// Run tracks a heartbeat right away, so that new pods show up without
+// waiting for an interval, and then every interval until ctx is done.
+func (hb *heartbeat) Run(ctx context.Context, interval time.Duration) {
+	hb.beat()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.beat()
+		}
+	}
+}
+
+func (hb *heartbeat) beat() {
+	spec, err := hb.state()
+
+	t := appinsights.NewMetricTelemetry(heartbeatMetricName, 0)
+	t.Properties["Kubernetes.Process.Uptime"] = strconv.FormatInt(int64(hb.now().Sub(hb.start)/time.Second), 10)
+
+	switch {
+	case spec != nil:
+		for k, v := range spec.ToPropertyMap() {
+			t.Properties[k] = v
+		}
+		t.Properties["Kubernetes.Container.RestartCount"] = strconv.Itoa(spec.RestartCount)
+		if spec.LastTermination != nil {
+			t.Properties["Kubernetes.Container.LastTermination.Reason"] = spec.LastTermination.Reason
+		}
+		t.Properties["Kubernetes.Enrichment.Status"] = enrichmentActive
+	case err != nil:
+		t.Value = 1
+		t.Properties["Kubernetes.Enrichment.Status"] = enrichmentInactive
+		t.Properties["Kubernetes.Enrichment.Error"] = err.Error()
+	default:
+		t.Properties["Kubernetes.Enrichment.Status"] = enrichmentPending
+	}
+
+	hb.track(t)
+}
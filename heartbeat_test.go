@@ -0,0 +1,139 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHeartbeatTest(spec *runtimeSpec, err error) (*heartbeat, *[]appinsights.Telemetry) {
+	var tracked []appinsights.Telemetry
+	hb := newHeartbeat(func(t appinsights.Telemetry) {
+		tracked = append(tracked, t)
+	}, func() (*runtimeSpec, error) {
+		return spec, err
+	})
+	hb.start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	hb.now = func() time.Time {
+		return hb.start.Add(90 * time.Second)
+	}
+
+	return hb, &tracked
+}
+
+func Test_That_Beat_Tracks_Spec_Uptime_And_Restart_Count(t *testing.T) {
+	spec := newSpec()
+	spec.RestartCount = 2
+	spec.LastTermination = &podContainerTerminatedSpec{Reason: "OOMKilled"}
+	hb, tracked := newHeartbeatTest(spec, nil)
+
+	hb.beat()
+
+	assert.Len(t, *tracked, 1)
+	metric := (*tracked)[0].(*appinsights.MetricTelemetry)
+	assert.Equal(t, "HeartbeatState", metric.Name)
+	assert.Equal(t, 0.0, metric.Value)
+	assert.Equal(t, "90", metric.Properties["Kubernetes.Process.Uptime"])
+	assert.Equal(t, "2", metric.Properties["Kubernetes.Container.RestartCount"])
+	assert.Equal(t, "OOMKilled", metric.Properties["Kubernetes.Container.LastTermination.Reason"])
+	assert.Equal(t, "Active", metric.Properties["Kubernetes.Enrichment.Status"])
+	for k, v := range spec.ToPropertyMap() {
+		assert.Equal(t, v, metric.Properties[k])
+	}
+}
+
+func Test_That_Run_Beats_On_Start(t *testing.T) {
+	hb, tracked := newHeartbeatTest(newSpec(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hb.Run(ctx, time.Hour)
+
+	assert.Len(t, *tracked, 1)
+}
+
+func Test_That_Beat_Reports_Enrichment_Error(t *testing.T) {
+	hb, tracked := newHeartbeatTest(nil, ErrForbidden)
+
+	hb.beat()
+
+	metric := (*tracked)[0].(*appinsights.MetricTelemetry)
+	assert.Equal(t, 1.0, metric.Value)
+	assert.Equal(t, "Inactive", metric.Properties["Kubernetes.Enrichment.Status"])
+	assert.Equal(t, ErrForbidden.Error(), metric.Properties["Kubernetes.Enrichment.Error"])
+	assert.NotContains(t, metric.Properties, "Kubernetes.Pod.Name")
+}
+
+func Test_That_Beat_Reports_Pending_Enrichment(t *testing.T) {
+	hb, tracked := newHeartbeatTest(nil, nil)
+
+	hb.beat()
+
+	metric := (*tracked)[0].(*appinsights.MetricTelemetry)
+	assert.Equal(t, 0.0, metric.Value)
+	assert.Equal(t, "Pending", metric.Properties["Kubernetes.Enrichment.Status"])
+}
+
+func Test_That_ResolvedSpec_Returns_Spec_After_Initialization(t *testing.T) {
+	c, _ := newProcessorTestClient()
+
+	spec, err := c.resolvedSpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, newSpec().PodName, spec.PodName)
+}
+
+func Test_That_ResolvedSpec_Skips_Initialization_When_Deferred(t *testing.T) {
+	c, _ := newProcessorTestClient()
+	c.deferred = true
+
+	spec, err := c.resolvedSpec()
+
+	assert.Nil(t, spec)
+	assert.NoError(t, err)
+	assert.False(t, c.isInitialized())
+}
+
+func Test_That_ResolvedSpec_Returns_Initialization_Error(t *testing.T) {
+	c, _ := newProcessorTestClient()
+	c.initializer = &mockInitializer{err: errors.New("error")}
+
+	spec, err := c.resolvedSpec()
+
+	assert.Nil(t, spec)
+	assert.Error(t, err)
+}
+
+func Test_That_Heartbeat_Is_Not_Aggregated(t *testing.T) {
+	c, m := newProcessorTestClient()
+	c.metrics = newMetricAggregator(c.Track)
+
+	newHeartbeat(c.process, c.resolvedSpec).beat()
+
+	assert.Len(t, m.items, 1)
+	assert.Equal(t, "HeartbeatState", m.items[0].(*appinsights.MetricTelemetry).Name)
+}
+
+func Test_That_NewTelemetryClient_Sends_Heartbeat_Outside_Kubernetes(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	m := &middleware_mockTelemetryClient{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newTelemetryClient(m, newOptions(
+		WithFileSystemRoot(root),
+		WithContext(ctx),
+		WithHeartbeat(time.Hour),
+	))
+
+	_, ok := c.(*kubernetesTelemetryClient)
+	assert.True(t, ok)
+	assert.Equal(t, ErrNotInCluster, EnrichmentError(c))
+}
@@ -1,19 +1,20 @@
 package appink8s
 
 import (
-	"errors"
 	"fmt"
 )
 
 const k8sContainerInfoPath = "/proc/self/cgroup"
 
 type k8sinitializer struct {
-	client *k8sclient
+	client  *k8sclient
+	podName string
 }
 
-func newK8sInitializer(c *k8sclient) *k8sinitializer {
+func newK8sInitializer(c *k8sclient, podName string) *k8sinitializer {
 	return &k8sinitializer{
-		client: c,
+		client:  c,
+		podName: podName,
 	}
 }
 
@@ -23,42 +24,77 @@ func (ki *k8sinitializer) ReadPropertySpec() (*runtimeSpec, error) {
 		return nil, err
 	}
 
-	pods, err := ki.client.GetPods()
-	if err != nil {
-		return nil, err
+	result := &runtimeSpec{
+		ContainerID: containerID,
 	}
 
-	nodes, err := ki.client.GetNodes()
+	var found *podSpec
+	err = ki.client.EachPod(func(pod podSpec) bool {
+		if !ki.match(pod, result) {
+			return true
+		}
+
+		found = &pod
+		return false
+	})
 	if err != nil {
 		return nil, err
 	}
+	if found == nil {
+		return nil, ErrPodNotFound
+	}
 
-	result := &runtimeSpec{
-		ContainerID: containerID,
+	result.NodeName = found.RuntimeSpec.NodeName
+	ki.readNodeSpec(result)
+
+	result.PodID = found.MetaData.ID
+	result.PodName = found.MetaData.Name
+	result.PodLabels = found.MetaData.GetLabels()
+	result.ReplicaSetName = found.FindReplicaSetName()
+	result.DeploymentName = found.FindDeploymentName()
+	return result, nil
+}
+
+// match reports whether pod runs the current container, or is the pod
+// configured by name, and sets the container status of result from it.
+func (ki *k8sinitializer) match(pod podSpec, result *runtimeSpec) bool {
+	found := false
+	for _, statuses := range pod.Status.ContainerStatuses {
+		if statuses.ID == fmt.Sprintf("docker://%s", result.ContainerID) {
+			result.setContainerStatus(statuses)
+			found = true
+		}
 	}
-	for _, pod := range pods.List {
-		found := false
-		for _, statuses := range pod.Status.ContainerStatuses {
-			if statuses.ID == fmt.Sprintf("docker://%s", containerID) {
-				result.ContainerName = statuses.Name
-				found = true
+
+	if !found && ki.podName != "" && pod.MetaData.Name == ki.podName {
+		found = true
+		if len(pod.Status.ContainerStatuses) > 0 {
+			status := pod.Status.ContainerStatuses[0]
+			result.setContainerStatus(status)
+			if result.ContainerID == "" {
+				result.ContainerID = status.RuntimeContainerID()
 			}
 		}
+	}
 
-		if found {
-			node := nodes.FindByName(pod.RuntimeSpec.NodeName)
-
-			result.NodeID = node.MetaData.ID
-			result.NodeName = node.MetaData.Name
-			result.NodeLabels = node.MetaData.GetLabels()
-			result.PodID = pod.MetaData.ID
-			result.PodName = pod.MetaData.Name
-			result.PodLabels = pod.MetaData.GetLabels()
-			result.ReplicaSetName = pod.FindReplicaSetName()
-			result.DeploymentName = pod.FindDeploymentName()
-			return result, nil
-		}
+	return found
+}
+
+// readNodeSpec adds node metadata to the spec when it can be read. Reading
+// nodes requires cluster scoped permissions which are often not granted to
+// application service accounts, and initialization is not retried, so any
+// failure leaves the node ID and labels empty rather than failing the whole
+// spec.
+func (ki *k8sinitializer) readNodeSpec(result *runtimeSpec) {
+	if result.NodeName == "" {
+		return
+	}
+
+	node, err := ki.client.GetNode(result.NodeName)
+	if err != nil {
+		return
 	}
 
-	return nil, errors.New("no runtime spec could be found")
+	result.NodeID = node.MetaData.ID
+	result.NodeLabels = node.MetaData.GetLabels()
 }
@@ -2,16 +2,19 @@ package appink8s
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 type initializer_mockFileReader struct {
 	token     string
+	modTime   time.Time
 	namespace string
 	cert      []byte
 	container string
@@ -22,6 +25,10 @@ func (m *initializer_mockFileReader) ReadTokenFile() (string, error) {
 	return m.token, m.err
 }
 
+func (m *initializer_mockFileReader) TokenModTime() (time.Time, error) {
+	return m.modTime, m.err
+}
+
 func (m *initializer_mockFileReader) ReadNamespaceFile() (string, error) {
 	return m.namespace, m.err
 }
@@ -34,20 +41,27 @@ func (m *initializer_mockFileReader) ReadContainerID() (string, error) {
 	return m.container, m.err
 }
 
-type initializer_mockHTTPClient struct{}
+type initializer_mockHTTPClient struct {
+	pods string
+}
 
 func (m *initializer_mockHTTPClient) Do(r *http.Request) (*http.Response, error) {
 	reqpath := strings.Split(r.URL.String(), "/")
 
-	if reqpath[len(reqpath)-1] == "nodes" {
+	if reqpath[len(reqpath)-2] == "nodes" {
 		return &http.Response{
 			Body:       ioutil.NopCloser(bytes.NewReader([]byte(k8sNodeResponse))),
 			StatusCode: 200,
 		}, nil
 	}
 
+	pods := m.pods
+	if pods == "" {
+		pods = k8sPodResponse
+	}
+
 	return &http.Response{
-		Body:       ioutil.NopCloser(bytes.NewReader([]byte(k8sPodResponse))),
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(pods))),
 		StatusCode: 200,
 	}, nil
 }
@@ -80,140 +94,280 @@ func Test_That_ReadPropertySpec_Parses_Kubernetes_Response(t *testing.T) {
 	assert.Equal(t, "TEST-NODE-NAME", spec.NodeName)
 }
 
+func Test_That_ReadPropertySpec_Reads_No_Termination_Without_Restart(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{
+			container: "TEST-CONTAINER-ID",
+		},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_mockHTTPClient{},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client: c,
+	}
+
+	spec, err := i.ReadPropertySpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, spec.RestartCount)
+	assert.Nil(t, spec.LastTermination)
+}
+
+func Test_That_ReadPropertySpec_Reads_Last_Container_Termination(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{
+			container: "TEST-CONTAINER-ID",
+		},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_mockHTTPClient{pods: k8sRestartedPodResponse},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client: c,
+	}
+
+	spec, err := i.ReadPropertySpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, spec.RestartCount)
+	assert.NotNil(t, spec.LastTermination)
+	assert.Equal(t, "OOMKilled", spec.LastTermination.Reason)
+	assert.Equal(t, 137, spec.LastTermination.ExitCode)
+	assert.Equal(t, time.Date(2020, 1, 23, 8, 18, 20, 0, time.UTC), spec.LastTermination.FinishedAt)
+}
+
+func Test_That_ReadPropertySpec_Matches_Configured_Pod_Name_Without_Container_ID(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_mockHTTPClient{},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client:  c,
+		podName: "TEST-POD-NAME",
+	}
+
+	spec, err := i.ReadPropertySpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST-POD-ID", spec.PodID)
+	assert.Equal(t, "TEST-CONTAINER-ID", spec.ContainerID)
+	assert.Equal(t, "TEST-CONTAINER-NAME", spec.ContainerName)
+	assert.Equal(t, "TEST-NODE-NAME", spec.NodeName)
+}
+
+func Test_That_ReadPropertySpec_Returns_ErrPodNotFound_For_Unknown_Container(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{
+			container: "UNKNOWN-CONTAINER-ID",
+		},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_mockHTTPClient{},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client: c,
+	}
+
+	_, err := i.ReadPropertySpec()
+
+	assert.Equal(t, ErrPodNotFound, err)
+}
+
+type initializer_failingNodesHTTPClient struct {
+	initializer_mockHTTPClient
+	status int
+}
+
+func (m *initializer_failingNodesHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	if strings.Contains(r.URL.Path, "/nodes/") {
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{"kind": "Status", "code": %d}`, m.status)))),
+			StatusCode: m.status,
+		}, nil
+	}
+
+	return m.initializer_mockHTTPClient.Do(r)
+}
+
+func Test_That_ReadPropertySpec_Keeps_Pod_Properties_When_Nodes_Are_Forbidden(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{
+			container: "TEST-CONTAINER-ID",
+		},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_failingNodesHTTPClient{status: 403},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client: c,
+	}
+
+	spec, err := i.ReadPropertySpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST-POD-NAME", spec.PodName)
+	assert.Equal(t, "TEST-NODE-NAME", spec.NodeName)
+	assert.Equal(t, "", spec.NodeID)
+	assert.Equal(t, "", spec.NodeLabels)
+}
+
+func Test_That_ReadPropertySpec_Keeps_Pod_Properties_When_Nodes_Fail(t *testing.T) {
+	cfg := &k8sconfig{
+		filereader: &initializer_mockFileReader{
+			container: "TEST-CONTAINER-ID",
+		},
+	}
+	c := &k8sclient{
+		httpclient: &initializer_failingNodesHTTPClient{status: 500},
+		k8sconfig:  cfg,
+	}
+	i := &k8sinitializer{
+		client: c,
+	}
+
+	spec, err := i.ReadPropertySpec()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST-POD-NAME", spec.PodName)
+	assert.Equal(t, "TEST-NODE-NAME", spec.NodeName)
+	assert.Equal(t, "", spec.NodeID)
+	assert.Equal(t, "", spec.NodeLabels)
+}
+
 const k8sNodeResponse = `{
-	"kind": "NodeList",
+	"kind": "Node",
 	"apiVersion": "v1",
 	"metadata": {
-	  "selfLink": "/api/v1/nodes",
-	  "resourceVersion": "20109945"
+	  "name": "TEST-NODE-NAME",
+	  "selfLink": "/api/v1/nodes/agentpool-0",
+	  "uid": "TEST-NODE-ID",
+	  "resourceVersion": "20109871",
+	  "creationTimestamp": "2019-09-10T08:06:20Z",
+	  "labels": {
+		"agentpool": "agentpool",
+		"beta.kubernetes.io/arch": "amd64",
+		"beta.kubernetes.io/instance-type": "Standard_D2s_v3",
+		"beta.kubernetes.io/os": "linux",
+		"failure-domain.beta.kubernetes.io/region": "westeurope",
+		"failure-domain.beta.kubernetes.io/zone": "1",
+		"kubernetes.azure.com/cluster": "MC_cluster",
+		"kubernetes.azure.com/role": "agent",
+		"kubernetes.io/arch": "amd64",
+		"kubernetes.io/hostname": "agentpool-0",
+		"kubernetes.io/os": "linux",
+		"kubernetes.io/role": "agent",
+		"node-role.kubernetes.io/agent": "",
+		"storageprofile": "managed",
+		"storagetier": "Premium_LRS"
+	  },
+	  "annotations": {
+		"node.alpha.kubernetes.io/ttl": "0",
+		"volumes.kubernetes.io/controller-managed-attach-detach": "true"
+	  }
 	},
-	"items": [
-	  {
-		"metadata": {
-		  "name": "TEST-NODE-NAME",
-		  "selfLink": "/api/v1/nodes/agentpool-0",
-		  "uid": "TEST-NODE-ID",
-		  "resourceVersion": "20109871",
-		  "creationTimestamp": "2019-09-10T08:06:20Z",
-		  "labels": {
-			"agentpool": "agentpool",
-			"beta.kubernetes.io/arch": "amd64",
-			"beta.kubernetes.io/instance-type": "Standard_D2s_v3",
-			"beta.kubernetes.io/os": "linux",
-			"failure-domain.beta.kubernetes.io/region": "westeurope",
-			"failure-domain.beta.kubernetes.io/zone": "1",
-			"kubernetes.azure.com/cluster": "MC_cluster",
-			"kubernetes.azure.com/role": "agent",
-			"kubernetes.io/arch": "amd64",
-			"kubernetes.io/hostname": "agentpool-0",
-			"kubernetes.io/os": "linux",
-			"kubernetes.io/role": "agent",
-			"node-role.kubernetes.io/agent": "",
-			"storageprofile": "managed",
-			"storagetier": "Premium_LRS"
-		  },
-		  "annotations": {
-			"node.alpha.kubernetes.io/ttl": "0",
-			"volumes.kubernetes.io/controller-managed-attach-detach": "true"
-		  }
+	"spec": {
+	  "podCIDR": "10.244.1.0/24",
+	  "providerID": "azure:///subscriptions/vm/agentpool-0"
+	},
+	"status": {
+	  "capacity": {
+		"attachable-volumes-azure-disk": "4",
+		"cpu": "2",
+		"ephemeral-storage": "50758760Ki",
+		"hugepages-1Gi": "0",
+		"hugepages-2Mi": "0",
+		"memory": "8145348Ki",
+		"pods": "110"
+	  },
+	  "allocatable": {
+		"attachable-volumes-azure-disk": "4",
+		"cpu": "1234m",
+		"ephemeral-storage": "46779273139",
+		"hugepages-1Gi": "0",
+		"hugepages-2Mi": "0",
+		"memory": "5490116Ki",
+		"pods": "110"
+	  },
+	  "conditions": [
+		{
+		  "type": "NetworkUnavailable",
+		  "status": "False",
+		  "lastHeartbeatTime": "2019-09-10T08:08:58Z",
+		  "lastTransitionTime": "2019-09-10T08:08:58Z",
+		  "reason": "RouteCreated",
+		  "message": "RouteController created a route"
 		},
-		"spec": {
-		  "podCIDR": "10.244.1.0/24",
-		  "providerID": "azure:///subscriptions/vm/agentpool-0"
+		{
+		  "type": "MemoryPressure",
+		  "status": "False",
+		  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
+		  "lastTransitionTime": "2020-01-04T02:12:27Z",
+		  "reason": "KubeletHasSufficientMemory",
+		  "message": "kubelet has sufficient memory available"
 		},
-		"status": {
-		  "capacity": {
-			"attachable-volumes-azure-disk": "4",
-			"cpu": "2",
-			"ephemeral-storage": "50758760Ki",
-			"hugepages-1Gi": "0",
-			"hugepages-2Mi": "0",
-			"memory": "8145348Ki",
-			"pods": "110"
-		  },
-		  "allocatable": {
-			"attachable-volumes-azure-disk": "4",
-			"cpu": "1234m",
-			"ephemeral-storage": "46779273139",
-			"hugepages-1Gi": "0",
-			"hugepages-2Mi": "0",
-			"memory": "5490116Ki",
-			"pods": "110"
-		  },
-		  "conditions": [
-			{
-			  "type": "NetworkUnavailable",
-			  "status": "False",
-			  "lastHeartbeatTime": "2019-09-10T08:08:58Z",
-			  "lastTransitionTime": "2019-09-10T08:08:58Z",
-			  "reason": "RouteCreated",
-			  "message": "RouteController created a route"
-			},
-			{
-			  "type": "MemoryPressure",
-			  "status": "False",
-			  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
-			  "lastTransitionTime": "2020-01-04T02:12:27Z",
-			  "reason": "KubeletHasSufficientMemory",
-			  "message": "kubelet has sufficient memory available"
-			},
-			{
-			  "type": "DiskPressure",
-			  "status": "False",
-			  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
-			  "lastTransitionTime": "2019-10-08T23:48:04Z",
-			  "reason": "KubeletHasNoDiskPressure",
-			  "message": "kubelet has no disk pressure"
-			},
-			{
-			  "type": "PIDPressure",
-			  "status": "False",
-			  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
-			  "lastTransitionTime": "2019-10-08T23:48:04Z",
-			  "reason": "KubeletHasSufficientPID",
-			  "message": "kubelet has sufficient PID available"
-			},
-			{
-			  "type": "Ready",
-			  "status": "True",
-			  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
-			  "lastTransitionTime": "2019-11-27T07:26:19Z",
-			  "reason": "KubeletReady",
-			  "message": "kubelet is posting ready status. AppArmor enabled"
-			}
-		  ],
-		  "addresses": [
-			{
-			  "type": "Hostname",
-			  "address": "agentpool-0"
-			},
-			{
-			  "type": "InternalIP",
-			  "address": "10.240.0.5"
-			}
-		  ],
-		  "daemonEndpoints": {
-			"kubeletEndpoint": {
-			  "Port": 10250
-			}
-		  },
-		  "nodeInfo": {
-			"machineID": "MACHINE-ID",
-			"systemUUID": "B2B5000D-33F1-5D43-91C1-B481B9F6C1B9",
-			"bootID": "1c2d2ccc-d748-48f3-ccab-5ac8db3c9d7f",
-			"kernelVersion": "4.15.0-1052-azure",
-			"osImage": "Ubuntu 16.04.6 LTS",
-			"containerRuntimeVersion": "docker://3.0.6",
-			"kubeletVersion": "v1.14.6",
-			"kubeProxyVersion": "v1.14.6",
-			"operatingSystem": "linux",
-			"architecture": "amd64"
-		  },
-		  "images": []
+		{
+		  "type": "DiskPressure",
+		  "status": "False",
+		  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
+		  "lastTransitionTime": "2019-10-08T23:48:04Z",
+		  "reason": "KubeletHasNoDiskPressure",
+		  "message": "kubelet has no disk pressure"
+		},
+		{
+		  "type": "PIDPressure",
+		  "status": "False",
+		  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
+		  "lastTransitionTime": "2019-10-08T23:48:04Z",
+		  "reason": "KubeletHasSufficientPID",
+		  "message": "kubelet has sufficient PID available"
+		},
+		{
+		  "type": "Ready",
+		  "status": "True",
+		  "lastHeartbeatTime": "2020-02-04T09:01:40Z",
+		  "lastTransitionTime": "2019-11-27T07:26:19Z",
+		  "reason": "KubeletReady",
+		  "message": "kubelet is posting ready status. AppArmor enabled"
 		}
-	  }
-	]
-  }`
+	  ],
+	  "addresses": [
+		{
+		  "type": "Hostname",
+		  "address": "agentpool-0"
+		},
+		{
+		  "type": "InternalIP",
+		  "address": "10.240.0.5"
+		}
+	  ],
+	  "daemonEndpoints": {
+		"kubeletEndpoint": {
+		  "Port": 10250
+		}
+	  },
+	  "nodeInfo": {
+		"machineID": "MACHINE-ID",
+		"systemUUID": "B2B5000D-33F1-5D43-91C1-B481B9F6C1B9",
+		"bootID": "1c2d2ccc-d748-48f3-ccab-5ac8db3c9d7f",
+		"kernelVersion": "4.15.0-1052-azure",
+		"osImage": "Ubuntu 16.04.6 LTS",
+		"containerRuntimeVersion": "docker://3.0.6",
+		"kubeletVersion": "v1.14.6",
+		"kubeProxyVersion": "v1.14.6",
+		"operatingSystem": "linux",
+		"architecture": "amd64"
+	  },
+	  "images": []
+	}
+}`
 
 const k8sPodResponse = `{
 	"kind": "PodList",
@@ -372,3 +526,18 @@ const k8sPodResponse = `{
 	  }
 	]
   }`
+
+// k8sRestartedPodResponse is k8sPodResponse after the container was
+// restarted twice, the last time for running out of memory.
+var k8sRestartedPodResponse = strings.NewReplacer(
+	`"lastState": {},`, `"lastState": {
+				"terminated": {
+				  "exitCode": 137,
+				  "reason": "OOMKilled",
+				  "startedAt": "2020-01-23T07:10:00Z",
+				  "finishedAt": "2020-01-23T08:18:20Z",
+				  "containerID": "docker://PREVIOUS-CONTAINER-ID"
+				}
+			  },`,
+	`"restartCount": 0,`, `"restartCount": 2,`,
+).Replace(k8sPodResponse)
@@ -0,0 +1,224 @@
+package appink8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// NewTelemetryClientFromFile creates a telemetry client with the
+// instrumentation key or connection string stored in the file at path,
+// typically a mounted Kubernetes Secret. The file is watched for changes,
+// and telemetry is switched over to the new key when it is rotated.
+func NewTelemetryClientFromFile(path string, opts ...Option) (appinsights.TelemetryClient, error) {
+	o := newOptions(opts...)
+
+	kf := &keyfile{
+		path:   path,
+		config: o.TelemetryConfiguration(""),
+	}
+
+	cfg, err := kf.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	rtc := newRotatingTelemetryClient(cfg)
+	go kf.Watch(o.ctx, o.watchInterval, rtc.Rotate)
+
+	return newTelemetryClient(rtc, o), nil
+}
+
+type keyfile struct {
+	path    string
+	config  *appinsights.TelemetryConfiguration
+	content []byte
+}
+
+func (kf *keyfile) Read() (*appinsights.TelemetryConfiguration, error) {
+	raw, err := ioutil.ReadFile(kf.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read instrumentation key file: %w", err)
+	}
+
+	cfg, err := parseKeyFile(string(raw), kf.config)
+	if err != nil {
+		return nil, err
+	}
+
+	kf.content = raw
+	return cfg, nil
+}
+
+// Watch polls the file rather than relying on file system events, since
+// Kubernetes updates secret volumes by atomically swapping the symlink of
+// the data directory, which leaves the file itself untouched. Reading
+// through the path always resolves the current target. Intervals that are
+// not positive fall back to the default interval.
+func (kf *keyfile) Watch(ctx context.Context, interval time.Duration, onChange func(*appinsights.TelemetryConfiguration)) {
+	if interval <= 0 {
+		interval = defaultFileWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			kf.check(onChange)
+		}
+	}
+}
+
+func (kf *keyfile) check(onChange func(*appinsights.TelemetryConfiguration)) {
+	raw, err := ioutil.ReadFile(kf.path)
+	if err != nil || bytes.Equal(raw, kf.content) {
+		return
+	}
+
+	cfg, err := parseKeyFile(string(raw), kf.config)
+	if err != nil {
+		return
+	}
+
+	kf.content = raw
+	onChange(cfg)
+}
+
+func parseKeyFile(raw string, base *appinsights.TelemetryConfiguration) (*appinsights.TelemetryConfiguration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("instrumentation key file is empty")
+	}
+
+	cfg := *base
+	if !strings.Contains(raw, "=") {
+		cfg.InstrumentationKey = raw
+		return &cfg, nil
+	}
+
+	cs, err := ParseConnectionString(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.InstrumentationKey = cs.InstrumentationKey
+	cfg.EndpointUrl = cs.TelemetryConfiguration().EndpointUrl
+	return &cfg, nil
+}
+
+type rotatingTelemetryClient struct {
+	lock    sync.RWMutex
+	current appinsights.TelemetryClient
+}
+
+func newRotatingTelemetryClient(cfg *appinsights.TelemetryConfiguration) *rotatingTelemetryClient {
+	return &rotatingTelemetryClient{
+		current: appinsights.NewTelemetryClientFromConfig(cfg),
+	}
+}
+
+// Rotate replaces the underlying client with one created from cfg. Tags,
+// common properties and the enabled state carry over, and the previous
+// channel is closed in the background so that queued telemetry is still
+// submitted with the previous key.
+func (rtc *rotatingTelemetryClient) Rotate(cfg *appinsights.TelemetryConfiguration) {
+	next := appinsights.NewTelemetryClientFromConfig(cfg)
+
+	rtc.lock.Lock()
+	previous := rtc.current
+
+	for k, v := range previous.Context().Tags {
+		next.Context().Tags[k] = v
+	}
+	for k, v := range previous.Context().CommonProperties {
+		next.Context().CommonProperties[k] = v
+	}
+	next.SetIsEnabled(previous.IsEnabled())
+
+	rtc.current = next
+	rtc.lock.Unlock()
+
+	go previous.Channel().Close()
+}
+
+// do runs f with the current client. The client is not rotated, and its
+// channel not closed, until f returns.
+func (rtc *rotatingTelemetryClient) do(f func(appinsights.TelemetryClient)) {
+	rtc.lock.RLock()
+	defer rtc.lock.RUnlock()
+
+	f(rtc.current)
+}
+
+func (rtc *rotatingTelemetryClient) client() appinsights.TelemetryClient {
+	rtc.lock.RLock()
+	defer rtc.lock.RUnlock()
+
+	return rtc.current
+}
+
+func (rtc *rotatingTelemetryClient) Context() *appinsights.TelemetryContext {
+	return rtc.client().Context()
+}
+
+func (rtc *rotatingTelemetryClient) InstrumentationKey() string {
+	return rtc.client().InstrumentationKey()
+}
+
+func (rtc *rotatingTelemetryClient) Channel() appinsights.TelemetryChannel {
+	return rtc.client().Channel()
+}
+
+func (rtc *rotatingTelemetryClient) IsEnabled() bool {
+	return rtc.client().IsEnabled()
+}
+
+func (rtc *rotatingTelemetryClient) SetIsEnabled(enabled bool) {
+	rtc.client().SetIsEnabled(enabled)
+}
+
+func (rtc *rotatingTelemetryClient) Track(t appinsights.Telemetry) {
+	rtc.do(func(tc appinsights.TelemetryClient) {
+		tc.Track(t)
+	})
+}
+
+func (rtc *rotatingTelemetryClient) TrackAvailability(name string, duration time.Duration, success bool) {
+	rtc.Track(appinsights.NewAvailabilityTelemetry(name, duration, success))
+}
+
+func (rtc *rotatingTelemetryClient) TrackEvent(name string) {
+	rtc.Track(appinsights.NewEventTelemetry(name))
+}
+
+func (rtc *rotatingTelemetryClient) TrackException(err interface{}) {
+	rtc.Track(appinsights.NewExceptionTelemetry(err))
+}
+
+func (rtc *rotatingTelemetryClient) TrackMetric(name string, value float64) {
+	rtc.Track(appinsights.NewMetricTelemetry(name, value))
+}
+
+func (rtc *rotatingTelemetryClient) TrackRemoteDependency(name, dependencyType, target string, success bool) {
+	rtc.Track(appinsights.NewRemoteDependencyTelemetry(name, dependencyType, target, success))
+}
+
+func (rtc *rotatingTelemetryClient) TrackRequest(method, uri string, duration time.Duration, responseCode string) {
+	rtc.Track(appinsights.NewRequestTelemetry(method, uri, duration, responseCode))
+}
+
+func (rtc *rotatingTelemetryClient) TrackTrace(name string, severity contracts.SeverityLevel) {
+	rtc.Track(appinsights.NewTraceTelemetry(name, severity))
+}
@@ -0,0 +1,138 @@
+package appink8s
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_ParseKeyFile_Reads_Bare_Instrumentation_Key(t *testing.T) {
+	base := appinsights.NewTelemetryConfiguration("")
+
+	cfg, err := parseKeyFile("  key\n", base)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cfg.InstrumentationKey)
+	assert.Equal(t, base.EndpointUrl, cfg.EndpointUrl)
+}
+
+func Test_That_ParseKeyFile_Reads_Connection_String(t *testing.T) {
+	base := appinsights.NewTelemetryConfiguration("")
+	base.MaxBatchSize = 10
+
+	cfg, err := parseKeyFile("InstrumentationKey=key;IngestionEndpoint=http://localhost:8080\n", base)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cfg.InstrumentationKey)
+	assert.Equal(t, "http://localhost:8080/v2/track", cfg.EndpointUrl)
+	assert.Equal(t, 10, cfg.MaxBatchSize)
+}
+
+func Test_That_ParseKeyFile_Fails_On_Empty_Content(t *testing.T) {
+	_, err := parseKeyFile("\n", appinsights.NewTelemetryConfiguration(""))
+
+	assert.Error(t, err)
+}
+
+func Test_That_Keyfile_Check_Detects_Symlink_Swap(t *testing.T) {
+	dir := newOptionsTestRoot(t)
+	defer os.RemoveAll(dir)
+
+	writeOptionsTestFile(t, dir, "..2020_01_01/key", "first")
+	writeOptionsTestFile(t, dir, "..2020_01_02/key", "second")
+	assert.NoError(t, os.Symlink("..2020_01_01", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink("..data/key", filepath.Join(dir, "key")))
+
+	kf := &keyfile{
+		path:   filepath.Join(dir, "key"),
+		config: appinsights.NewTelemetryConfiguration(""),
+	}
+	_, err := kf.Read()
+	assert.NoError(t, err)
+
+	var rotated []string
+	onChange := func(cfg *appinsights.TelemetryConfiguration) {
+		rotated = append(rotated, cfg.InstrumentationKey)
+	}
+
+	kf.check(onChange)
+	assert.Empty(t, rotated)
+
+	assert.NoError(t, os.Symlink("..2020_01_02", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	kf.check(onChange)
+	kf.check(onChange)
+	assert.Equal(t, []string{"second"}, rotated)
+}
+
+func Test_That_Keyfile_Check_Keeps_Previous_Key_On_Read_Error(t *testing.T) {
+	dir := newOptionsTestRoot(t)
+	defer os.RemoveAll(dir)
+	writeOptionsTestFile(t, dir, "key", "first")
+
+	kf := &keyfile{
+		path:   filepath.Join(dir, "key"),
+		config: appinsights.NewTelemetryConfiguration(""),
+	}
+	_, err := kf.Read()
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(kf.path, []byte(""), 0644))
+
+	called := false
+	kf.check(func(*appinsights.TelemetryConfiguration) { called = true })
+	assert.False(t, called)
+}
+
+func Test_That_Rotate_Switches_Key_And_Keeps_Context(t *testing.T) {
+	rtc := newRotatingTelemetryClient(appinsights.NewTelemetryConfiguration("first"))
+	rtc.Context().Tags.Cloud().SetRole("role")
+	rtc.Context().CommonProperties["prop"] = "value"
+	rtc.SetIsEnabled(false)
+
+	rtc.Rotate(appinsights.NewTelemetryConfiguration("second"))
+
+	assert.Equal(t, "second", rtc.InstrumentationKey())
+	assert.Equal(t, "role", rtc.Context().Tags.Cloud().GetRole())
+	assert.Equal(t, "value", rtc.Context().CommonProperties["prop"])
+	assert.False(t, rtc.IsEnabled())
+}
+
+func Test_That_Keyfile_Watch_Falls_Back_To_Default_Interval(t *testing.T) {
+	kf := &keyfile{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NotPanics(t, func() {
+		kf.Watch(ctx, 0, func(*appinsights.TelemetryConfiguration) {})
+		kf.Watch(ctx, -time.Second, func(*appinsights.TelemetryConfiguration) {})
+	})
+}
+
+func Test_That_Send_Uses_Context_And_Channel_Of_Current_Client(t *testing.T) {
+	first := &sampling_mockTelemetryClient{channel: &sampling_mockChannel{}}
+	first.ctx = appinsights.NewTelemetryContext("first")
+	second := &sampling_mockTelemetryClient{channel: &sampling_mockChannel{}}
+	second.ctx = appinsights.NewTelemetryContext("second")
+
+	rtc := &rotatingTelemetryClient{current: first}
+	c := &kubernetesTelemetryClient{TelemetryClient: rtc}
+
+	c.send(newSamplingTestRequest("op"), 50)
+	rtc.lock.Lock()
+	rtc.current = second
+	rtc.lock.Unlock()
+	c.send(newSamplingTestRequest("op"), 50)
+
+	assert.Len(t, first.channel.envelopes, 1)
+	assert.Equal(t, "first", first.channel.envelopes[0].IKey)
+	assert.Len(t, second.channel.envelopes, 1)
+	assert.Equal(t, "second", second.channel.envelopes[0].IKey)
+}
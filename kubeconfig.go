@@ -0,0 +1,300 @@
+package appink8s
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const kubeconfigEnvironmentVariable = "KUBECONFIG"
+const defaultNamespace = "default"
+
+type kubeconfigClusterSpec struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+}
+
+type kubeconfigUserSpec struct {
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"`
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+}
+
+type kubeconfigContextSpec struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+type kubeconfigSpec struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string                `yaml:"name"`
+		Cluster kubeconfigClusterSpec `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string             `yaml:"name"`
+		User kubeconfigUserSpec `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string                `yaml:"name"`
+		Context kubeconfigContextSpec `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeconfig holds the cluster and user of the current context of a
+// kubeconfig file, and implements filereader for running outside the
+// cluster.
+type kubeconfig struct {
+	dir       string
+	namespace string
+	cluster   kubeconfigClusterSpec
+	user      kubeconfigUserSpec
+}
+
+func kubeconfigPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	for _, p := range filepath.SplitList(os.Getenv(kubeconfigEnvironmentVariable)) {
+		if p != "" {
+			return p, nil
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find kubeconfig: %w", err)
+	}
+
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+func readKubeconfig(path, namespace string) (*kubeconfig, error) {
+	path, err := kubeconfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read kubeconfig: %w", err)
+	}
+
+	kc, err := parseKubeconfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	kc.dir = filepath.Dir(path)
+	if namespace != "" {
+		kc.namespace = namespace
+	}
+
+	return kc, nil
+}
+
+func parseKubeconfig(raw []byte) (*kubeconfig, error) {
+	var spec kubeconfigSpec
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("could not parse kubeconfig: %w", err)
+	}
+
+	var ctx *kubeconfigContextSpec
+	for i := range spec.Contexts {
+		if spec.Contexts[i].Name == spec.CurrentContext {
+			ctx = &spec.Contexts[i].Context
+		}
+	}
+	if ctx == nil {
+		return nil, fmt.Errorf("could not find kubeconfig context %q", spec.CurrentContext)
+	}
+
+	kc := &kubeconfig{
+		namespace: ctx.Namespace,
+	}
+	if kc.namespace == "" {
+		kc.namespace = defaultNamespace
+	}
+
+	found := false
+	for _, c := range spec.Clusters {
+		if c.Name == ctx.Cluster {
+			kc.cluster = c.Cluster
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("could not find kubeconfig cluster %q", ctx.Cluster)
+	}
+
+	for _, u := range spec.Users {
+		if u.Name == ctx.User {
+			kc.user = u.User
+		}
+	}
+
+	return kc, nil
+}
+
+func (kc *kubeconfig) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(kc.dir, p)
+}
+
+func (kc *kubeconfig) readData(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(kc.path(file))
+	}
+
+	return nil, nil
+}
+
+func (kc *kubeconfig) ReadTokenFile() (string, error) {
+	if kc.user.Token != "" {
+		return kc.user.Token, nil
+	}
+	if kc.user.TokenFile == "" {
+		return "", nil
+	}
+
+	token, err := ioutil.ReadFile(kc.path(kc.user.TokenFile))
+	if err != nil {
+		return "", err
+	}
+
+	return string(token), nil
+}
+
+func (kc *kubeconfig) TokenModTime() (time.Time, error) {
+	if kc.user.Token != "" || kc.user.TokenFile == "" {
+		return time.Time{}, nil
+	}
+
+	fi, err := os.Stat(kc.path(kc.user.TokenFile))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+func (kc *kubeconfig) ReadNamespaceFile() (string, error) {
+	return kc.namespace, nil
+}
+
+func (kc *kubeconfig) ReadCertFile() ([]byte, error) {
+	return kc.readData(kc.cluster.CertificateAuthorityData, kc.cluster.CertificateAuthority)
+}
+
+func (kc *kubeconfig) ReadContainerID() (string, error) {
+	return "", nil
+}
+
+func (kc *kubeconfig) ClientCertificate() (*tls.Certificate, error) {
+	cert, err := kc.readData(kc.user.ClientCertificateData, kc.user.ClientCertificate)
+	if err != nil || cert == nil {
+		return nil, err
+	}
+
+	key, err := kc.readData(kc.user.ClientKeyData, kc.user.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig client certificate: %w", err)
+	}
+
+	return &pair, nil
+}
+
+func (kc *kubeconfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: kc.cluster.InsecureSkipTLSVerify,
+	}
+
+	ca, err := kc.ReadCertFile()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving certificate: %w", err)
+	}
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("could not create certificate pool with kubeconfig certificate")
+		}
+		cfg.RootCAs = pool
+	}
+
+	cert, err := kc.ClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+
+	return cfg, nil
+}
+
+func newKubeconfigClient(o *options) (*k8sclient, error) {
+	kc, err := readKubeconfig(o.kubeconfig, o.podNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &k8sconfig{
+		filereader: kc,
+	}
+
+	var c httpclient
+	switch {
+	case o.httpClient != nil:
+		c = o.httpClient
+	case o.roundTripper != nil:
+		c = &http.Client{Transport: o.roundTripper}
+	default:
+		tls, err := kc.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		c = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tls,
+			},
+		}
+	}
+
+	return &k8sclient{
+		httpclient: c,
+		k8sconfig:  cfg,
+		host:       kc.cluster.Server,
+		timeout:    o.requestTimeout,
+		nodeName:   o.nodeName,
+		podIP:      o.podIP,
+		pageSize:   o.pageSize,
+		limiter:    o.limiter,
+	}, nil
+}
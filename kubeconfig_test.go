@@ -0,0 +1,172 @@
+package appink8s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const kubeconfigWithToken = `
+apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: other
+  cluster:
+    server: https://other:6443
+- name: dev-cluster
+  cluster:
+    server: https://dev:6443
+    insecure-skip-tls-verify: true
+users:
+- name: dev-user
+  user:
+    token: dev-token
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+    namespace: shop
+`
+
+func Test_That_ParseKubeconfig_Uses_Current_Context(t *testing.T) {
+	kc, err := parseKubeconfig([]byte(kubeconfigWithToken))
+	assert.NoError(t, err)
+
+	token, _ := kc.ReadTokenFile()
+	namespace, _ := kc.ReadNamespaceFile()
+
+	assert.Equal(t, "https://dev:6443", kc.cluster.Server)
+	assert.Equal(t, "dev-token", token)
+	assert.Equal(t, "shop", namespace)
+}
+
+func Test_That_ParseKubeconfig_Defaults_Namespace(t *testing.T) {
+	raw := `
+current-context: dev
+clusters:
+- name: c
+  cluster:
+    server: https://dev:6443
+contexts:
+- name: dev
+  context:
+    cluster: c
+`
+	kc, err := parseKubeconfig([]byte(raw))
+	assert.NoError(t, err)
+
+	namespace, _ := kc.ReadNamespaceFile()
+	assert.Equal(t, defaultNamespace, namespace)
+}
+
+func Test_That_ParseKubeconfig_Fails_On_Missing_Context(t *testing.T) {
+	_, err := parseKubeconfig([]byte(`current-context: missing`))
+
+	assert.Error(t, err)
+}
+
+func Test_That_ReadKubeconfig_Reads_Path_From_Environment(t *testing.T) {
+	dir := newOptionsTestRoot(t)
+	defer os.RemoveAll(dir)
+	writeOptionsTestFile(t, dir, "config", kubeconfigWithToken)
+
+	os.Setenv(kubeconfigEnvironmentVariable, filepath.Join(dir, "config"))
+	defer os.Unsetenv(kubeconfigEnvironmentVariable)
+
+	kc, err := readKubeconfig("", "override")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev:6443", kc.cluster.Server)
+	assert.Equal(t, "override", kc.namespace)
+}
+
+func Test_That_Kubeconfig_Resolves_Relative_Token_File(t *testing.T) {
+	dir := newOptionsTestRoot(t)
+	defer os.RemoveAll(dir)
+	writeOptionsTestFile(t, dir, "token", "file-token")
+
+	kc := &kubeconfig{
+		dir: dir,
+		user: kubeconfigUserSpec{
+			TokenFile: "token",
+		},
+	}
+
+	token, err := kc.ReadTokenFile()
+	assert.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+}
+
+func Test_That_Kubeconfig_TLSConfig_Loads_Client_Certificate(t *testing.T) {
+	cert, key := newKubeconfigTestCertificate(t)
+	kc := &kubeconfig{
+		cluster: kubeconfigClusterSpec{
+			CertificateAuthorityData: base64.StdEncoding.EncodeToString(cert),
+		},
+		user: kubeconfigUserSpec{
+			ClientCertificateData: base64.StdEncoding.EncodeToString(cert),
+			ClientKeyData:         base64.StdEncoding.EncodeToString(key),
+		},
+	}
+
+	cfg, err := kc.TLSConfig()
+
+	assert.NoError(t, err)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.Len(t, cfg.Certificates, 1)
+}
+
+func Test_That_NewKubeconfigClient_Uses_Cluster_Server(t *testing.T) {
+	dir := newOptionsTestRoot(t)
+	defer os.RemoveAll(dir)
+	writeOptionsTestFile(t, dir, "config", kubeconfigWithToken)
+
+	c, err := newKubeconfigClient(newOptions(WithKubeconfig(filepath.Join(dir, "config"))))
+	assert.NoError(t, err)
+
+	u, err := c.PodListURI()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev:6443/api/v1/namespaces/shop/pods", u.String())
+}
+
+func newKubeconfigTestCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM
+}
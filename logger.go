@@ -0,0 +1,136 @@
+package appink8s
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// maxSeverityPrefixFields is how many words at the start of a log entry
+// are searched for a severity prefix, to skip the prefix, date, time and
+// file name that a log.Logger may write before the message.
+const maxSeverityPrefixFields = 5
+
+// LogOption configures the writer created by NewLogWriter.
+type LogOption func(*logwriter)
+
+type severityPrefix struct {
+	prefix   string
+	severity contracts.SeverityLevel
+}
+
+var defaultSeverityPrefixes = []severityPrefix{
+	{"CRITICAL", contracts.Critical},
+	{"FATAL", contracts.Critical},
+	{"PANIC", contracts.Critical},
+	{"ERROR", contracts.Error},
+	{"ERR", contracts.Error},
+	{"WARNING", contracts.Warning},
+	{"WARN", contracts.Warning},
+	{"INFO", contracts.Information},
+	{"DEBUG", contracts.Verbose},
+	{"TRACE", contracts.Verbose},
+}
+
+type logwriter struct {
+	client          appinsights.TelemetryClient
+	out             io.Writer
+	prefixes        []severityPrefix
+	defaultSeverity contracts.SeverityLevel
+	lock            sync.Mutex
+	buf             bytes.Buffer
+}
+
+// WithSeverityPrefix maps log entries with prefix, e.g. "AUDIT", to
+// severity. Prefixes added this way take precedence over the default
+// prefixes ERROR, WARN, INFO, DEBUG and so on.
+func WithSeverityPrefix(prefix string, severity contracts.SeverityLevel) LogOption {
+	return func(w *logwriter) {
+		w.prefixes = append([]severityPrefix{{prefix, severity}}, w.prefixes...)
+	}
+}
+
+// WithDefaultSeverity sets the severity of log entries without a severity
+// prefix. The default is Information.
+func WithDefaultSeverity(severity contracts.SeverityLevel) LogOption {
+	return func(w *logwriter) {
+		w.defaultSeverity = severity
+	}
+}
+
+// NewLogWriter returns an io.Writer that tracks every log entry written to
+// it as a trace with client, and also writes it to out unless out is nil.
+// The severity of an entry is taken from a prefix such as ERROR or [WARN]
+// near its start. An entry is everything up to the newline that ends a
+// write, so multiline entries, e.g. with a stack trace, are tracked as one
+// trace.
+func NewLogWriter(client appinsights.TelemetryClient, out io.Writer, opts ...LogOption) io.Writer {
+	w := &logwriter{
+		client:          client,
+		out:             out,
+		prefixes:        append([]severityPrefix(nil), defaultSeverityPrefixes...),
+		defaultSeverity: contracts.Information,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// NewLogger returns a *log.Logger that writes to a writer created by
+// NewLogWriter, with the given prefix and flags as in log.New.
+func NewLogger(client appinsights.TelemetryClient, out io.Writer, prefix string, flag int, opts ...LogOption) *log.Logger {
+	return log.New(NewLogWriter(client, out, opts...), prefix, flag)
+}
+
+func (w *logwriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var err error
+	if w.out != nil {
+		n, err = w.out.Write(p)
+	}
+
+	w.lock.Lock()
+	w.buf.Write(p)
+	var entry string
+	if bytes.HasSuffix(p, []byte("\n")) {
+		entry = strings.TrimRight(w.buf.String(), "\r\n")
+		w.buf.Reset()
+	}
+	w.lock.Unlock()
+
+	if strings.TrimSpace(entry) != "" {
+		w.client.Track(appinsights.NewTraceTelemetry(entry, w.severity(entry)))
+	}
+
+	return n, err
+}
+
+func (w *logwriter) severity(entry string) contracts.SeverityLevel {
+	firstLine := entry
+	if i := strings.IndexByte(entry, '\n'); i >= 0 {
+		firstLine = entry[:i]
+	}
+
+	fields := strings.Fields(firstLine)
+	if len(fields) > maxSeverityPrefixFields {
+		fields = fields[:maxSeverityPrefixFields]
+	}
+
+	for _, field := range fields {
+		word := strings.Trim(field, "[]():|")
+		for _, p := range w.prefixes {
+			if word == p.prefix {
+				return p.severity
+			}
+		}
+	}
+
+	return w.defaultSeverity
+}
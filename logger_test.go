@@ -0,0 +1,89 @@
+package appink8s
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_NewLogger_Tracks_Entries_As_Traces_And_Tees_Output(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	var out bytes.Buffer
+	logger := NewLogger(client, &out, "orders ", log.LstdFlags)
+
+	logger.Println("ERROR could not place order")
+
+	assert.Contains(t, out.String(), "ERROR could not place order\n")
+	trace := client.items[0].(*appinsights.TraceTelemetry)
+	assert.Equal(t, contracts.Error, trace.SeverityLevel)
+	assert.Contains(t, trace.Message, "orders ")
+	assert.NotContains(t, trace.Message, "\n")
+}
+
+func Test_That_LogWriter_Maps_Severity_Prefixes(t *testing.T) {
+	cases := map[string]contracts.SeverityLevel{
+		"[WARN] disk almost full":      contracts.Warning,
+		"2020/01/23 08:18:20 DEBUG: x": contracts.Verbose,
+		"FATAL out of memory":          contracts.Critical,
+		"no severity prefix":           contracts.Information,
+		"an error in the message body": contracts.Information,
+	}
+
+	for entry, severity := range cases {
+		client := &middleware_mockTelemetryClient{}
+		w := NewLogWriter(client, nil)
+
+		w.Write([]byte(entry + "\n"))
+
+		trace := client.items[0].(*appinsights.TraceTelemetry)
+		assert.Equal(t, severity, trace.SeverityLevel, entry)
+	}
+}
+
+func Test_That_LogWriter_Uses_Configured_Severities(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	w := NewLogWriter(client, nil,
+		WithSeverityPrefix("AUDIT", contracts.Warning),
+		WithDefaultSeverity(contracts.Verbose),
+	)
+
+	w.Write([]byte("AUDIT user signed in\n"))
+	w.Write([]byte("request served\n"))
+
+	assert.Equal(t, contracts.Warning, client.items[0].(*appinsights.TraceTelemetry).SeverityLevel)
+	assert.Equal(t, contracts.Verbose, client.items[1].(*appinsights.TraceTelemetry).SeverityLevel)
+}
+
+func Test_That_LogWriter_Tracks_Multiline_Entries_Once(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	w := NewLogWriter(client, nil)
+
+	w.Write([]byte("ERROR panic: boom\n\tgoroutine 1 [running]:"))
+	w.Write([]byte("\n\tmain.main()\n"))
+
+	assert.Len(t, client.items, 1)
+	trace := client.items[0].(*appinsights.TraceTelemetry)
+	assert.Equal(t, "ERROR panic: boom\n\tgoroutine 1 [running]:\n\tmain.main()", trace.Message)
+	assert.Equal(t, contracts.Error, trace.SeverityLevel)
+}
+
+func Test_That_LogWriter_Adds_Kubernetes_Properties(t *testing.T) {
+	s := newSpec()
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initializer:     &mockInitializer{spec: s},
+	}
+
+	NewLogWriter(c, nil).Write([]byte("WARN slow request\n"))
+
+	trace := m.tracked.(*appinsights.TraceTelemetry)
+	assert.Equal(t, s.PodName, trace.Properties["Kubernetes.Pod.Name"])
+}
@@ -0,0 +1,269 @@
+package appink8s
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// MiddlewareOption configures the middleware created by Middleware.
+type MiddlewareOption func(*middleware)
+
+type middleware struct {
+	client    appinsights.TelemetryClient
+	next      http.Handler
+	routeName func(*http.Request) string
+	proxies   []*net.IPNet
+}
+
+// WithRouteName names requests by route rather than by URL path, e.g.
+// "/orders/{id}", so that requests to the same route are grouped. An empty
+// name falls back to the URL path. f is called with the request passed to
+// the handler once it returns, when routers have set the matched route,
+// e.g. the Pattern of http.ServeMux.
+func WithRouteName(f func(*http.Request) string) MiddlewareOption {
+	return func(m *middleware) {
+		m.routeName = f
+	}
+}
+
+// WithTrustedProxies trusts the X-Forwarded-For header of requests from
+// the given networks, e.g. an ingress controller or a sidecar proxy. The
+// client IP is then the right-most address in the header that is not a
+// trusted proxy. Without trusted proxies, the header is ignored, since any
+// client can set it.
+func WithTrustedProxies(networks ...*net.IPNet) MiddlewareOption {
+	return func(m *middleware) {
+		m.proxies = append(m.proxies, networks...)
+	}
+}
+
+// Middleware returns net/http middleware that tracks every request as
+// request telemetry with client. The operation of the request is read from
+// the traceparent or Request-Id headers, or started when missing, and put
+// on the request context for telemetry tracked while handling it.
+// Properties the handler attaches with WithProperties are added to the
+// request telemetry. Panics are tracked as exceptions and answered with 500
+// Internal Server Error.
+func Middleware(client appinsights.TelemetryClient, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		m := &middleware{
+			client: client,
+			next:   next,
+		}
+		for _, opt := range opts {
+			opt(m)
+		}
+
+		return m
+	}
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	op := operationFromHeaders(r.Header, m.name(r))
+	rw := &statusResponseWriter{ResponseWriter: w}
+	ctx, properties := withRequestProperties(WithOperation(r.Context(), op))
+	req := r.WithContext(ctx)
+
+	defer func() {
+		recovered := recover()
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+		if recovered != nil {
+			TrackContext(ctx, m.client, appinsights.NewExceptionTelemetry(recovered))
+
+			if !rw.written {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+			rw.status = http.StatusInternalServerError
+		}
+
+		// Routers set the matched route on the request while they
+		// dispatch it, so the name is taken from the request passed on.
+		op.Name = m.name(req)
+		t := m.newRequestTelemetry(r, op, rw.Status(), start)
+		properties.apply(t.Properties)
+		TrackContext(r.Context(), m.client, t)
+	}()
+
+	m.next.ServeHTTP(rw, req)
+}
+
+// name returns the method and route of r, e.g. "GET /orders/{id}". Routes
+// that start with the method already, like the patterns of http.ServeMux,
+// are not prefixed again.
+func (m *middleware) name(r *http.Request) string {
+	route := m.route(r)
+	if strings.HasPrefix(route, r.Method+" ") {
+		return route
+	}
+
+	return fmt.Sprintf("%s %s", r.Method, route)
+}
+
+func (m *middleware) route(r *http.Request) string {
+	if m.routeName != nil {
+		if route := m.routeName(r); route != "" {
+			return route
+		}
+	}
+
+	return r.URL.Path
+}
+
+func (m *middleware) newRequestTelemetry(r *http.Request, op Operation, status int, start time.Time) *appinsights.RequestTelemetry {
+	t := appinsights.NewRequestTelemetry(r.Method, requestURL(r), time.Since(start), strconv.Itoa(status))
+	t.Timestamp = start
+	t.Id = op.TelemetryID()
+	t.Name = op.Name
+	t.Tags.Operation().SetId(op.ID)
+	t.Tags.Operation().SetName(op.Name)
+	if op.ParentID != "" {
+		t.Tags.Operation().SetParentId(op.ParentID)
+	}
+	if ip := m.clientIP(r); ip != "" {
+		t.Tags.Location().SetIp(ip)
+	}
+
+	return t
+}
+
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+}
+
+// clientIP returns the IP of the client that made the request. For
+// requests from trusted proxies, the X-Forwarded-For header is walked from
+// the right, past the trusted proxies, to the address that the last
+// trusted proxy received the request from.
+func (m *middleware) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !m.isTrustedProxy(ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !m.isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (m *middleware) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range m.proxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP of the peer that sent the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// statusResponseWriter records the status code written by a handler.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.written {
+		w.status = status
+		w.written = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, e.g. for WebSockets, and records the
+// request as switching protocols.
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil && !w.written {
+		w.status = http.StatusSwitchingProtocols
+		w.written = true
+	}
+
+	return conn, rw, err
+}
+
+func (w *statusResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped response writer, for http.ResponseController.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
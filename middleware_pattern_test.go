@@ -0,0 +1,30 @@
+//go:build go1.22
+// +build go1.22
+
+//go:debug httpmuxgo121=0
+
+package appink8s
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_Middleware_Names_Requests_By_Pattern_Of_ServeMux(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	h := Middleware(client, WithRouteName(func(r *http.Request) string {
+		return r.Pattern
+	}))(mux)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders/42", nil))
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "GET /orders/{id}", request.Name)
+	assert.Equal(t, "GET /orders/{id}", request.Tags.Operation().GetName())
+}
@@ -0,0 +1,210 @@
+package appink8s
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+type middleware_mockTelemetryClient struct {
+	mockTelemetryClient
+	items []appinsights.Telemetry
+}
+
+func (m *middleware_mockTelemetryClient) Track(t appinsights.Telemetry) {
+	m.items = append(m.items, t)
+}
+
+type middleware_mockHijacker struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (m *middleware_mockHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	m.hijacked = true
+	return nil, nil, nil
+}
+
+func Test_That_Middleware_Tracks_Request(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest("GET", "http://orders/orders/12?verbose=1", nil)
+	req.RemoteAddr = "10.1.2.3:51234"
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Len(t, client.items, 1)
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "GET /orders/12", request.Name)
+	assert.Equal(t, "http://orders/orders/12?verbose=1", request.Url)
+	assert.Equal(t, "404", request.ResponseCode)
+	assert.False(t, request.Success)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", request.Tags.Operation().GetId())
+	assert.Equal(t, "|0af7651916cd43dd8448eb211c80319c.b7ad6b7169203331.", request.Tags.Operation().GetParentId())
+	assert.Equal(t, "10.1.2.3", request.Tags.Location().GetIp())
+}
+
+func Test_That_Middleware_Names_Requests_By_Route(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client, WithRouteName(func(r *http.Request) string {
+		return "/orders/{id}"
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders/12", nil))
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "POST /orders/{id}", request.Name)
+	assert.Equal(t, "POST /orders/{id}", request.Tags.Operation().GetName())
+	assert.Equal(t, "200", request.ResponseCode)
+}
+
+func Test_That_Middleware_Puts_Operation_On_Request_Context(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	var op Operation
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, _ = OperationFromContext(r.Context())
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, op.TelemetryID(), request.Id)
+	assert.Equal(t, op.ID, request.Tags.Operation().GetId())
+}
+
+func Test_That_Middleware_Adds_Properties_Attached_By_Handler(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithProperties(r.Context(), map[string]string{"Tenant": "contoso"})
+		_ = WithProperties(ctx, map[string]string{"User": "42"})
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithProperties(req.Context(), map[string]string{"Region": "westeurope"}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "contoso", request.Properties["Tenant"])
+	assert.Equal(t, "42", request.Properties["User"])
+	assert.Equal(t, "westeurope", request.Properties["Region"])
+}
+
+func Test_That_Middleware_Recovers_Panics_As_Exceptions(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("boom"))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Len(t, client.items, 2)
+	exception := client.items[0].(*appinsights.ExceptionTelemetry)
+	request := client.items[1].(*appinsights.RequestTelemetry)
+	assert.Equal(t, request.Id, exception.Tags.Operation().GetParentId())
+	assert.Equal(t, "500", request.ResponseCode)
+}
+
+func Test_That_Middleware_Repanics_On_Aborted_Handlers(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	assert.Empty(t, client.items)
+}
+
+func Test_That_Middleware_Ignores_Forwarded_Client_IP_By_Default(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.0.2:51234"
+	req.Header.Set("X-Forwarded-For", "10.1.0.5")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "10.1.0.2", request.Tags.Location().GetIp())
+}
+
+func Test_That_Middleware_Takes_Right_Most_Untrusted_Forwarded_Client_IP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.2.0.0/16")
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client, WithTrustedProxies(proxies))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.2.0.3:51234"
+	req.Header.Set("X-Forwarded-For", "10.9.9.9, 10.1.0.5, 10.2.0.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "10.1.0.5", request.Tags.Location().GetIp())
+}
+
+func Test_That_Middleware_Ignores_Forwarded_Client_IP_From_Untrusted_Peer(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.2.0.0/16")
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client, WithTrustedProxies(proxies))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.0.2:51234"
+	req.Header.Set("X-Forwarded-For", "10.1.0.5")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "10.1.0.2", request.Tags.Location().GetIp())
+}
+
+func Test_That_Middleware_Delegates_Hijack_And_Records_Switching_Protocols(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.NoError(t, err)
+	}))
+
+	w := &middleware_mockHijacker{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ws", nil))
+
+	assert.True(t, w.hijacked)
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "101", request.ResponseCode)
+}
+
+func Test_That_Middleware_Reports_Unsupported_Hijack_And_Push(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	h := Middleware(client)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.Error(t, err)
+		assert.Equal(t, http.ErrNotSupported, w.(http.Pusher).Push("/style.css", nil))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	request := client.items[0].(*appinsights.RequestTelemetry)
+	assert.Equal(t, "200", request.ResponseCode)
+}
+
+func Test_That_Middleware_Response_Writer_Unwraps_To_Original(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	var unwrapped http.ResponseWriter
+	h := Middleware(&middleware_mockTelemetryClient{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unwrapped = w.(interface{ Unwrap() http.ResponseWriter }).Unwrap()
+	}))
+
+	h.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, recorder, unwrapped)
+}
@@ -0,0 +1,133 @@
+package appink8s
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+const traceparentHeader = "traceparent"
+const requestIDHeader = "Request-Id"
+
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+type operationContextKey struct{}
+
+// Operation identifies the distributed operation that telemetry is part of,
+// following the W3C Trace Context and the Application Insights Request-Id
+// conventions. ID is the trace ID shared by all telemetry of the
+// operation, SpanID identifies the current request within it, and
+// ParentID is the telemetry ID of the caller, if any.
+type Operation struct {
+	ID       string
+	SpanID   string
+	ParentID string
+	Name     string
+}
+
+// NewOperation starts a new distributed operation without a parent.
+func NewOperation(name string) Operation {
+	return Operation{
+		ID:     newTraceID(),
+		SpanID: newSpanID(),
+		Name:   name,
+	}
+}
+
+// operationFromHeaders continues the operation of the caller, read from the
+// traceparent header or else the Request-Id header. A new operation is
+// started when neither is present or valid.
+func operationFromHeaders(h http.Header, name string) Operation {
+	if m := traceparentPattern.FindStringSubmatch(h.Get(traceparentHeader)); m != nil && m[1] != strings.Repeat("0", 32) {
+		return Operation{
+			ID:       m[1],
+			SpanID:   newSpanID(),
+			ParentID: fmt.Sprintf("|%s.%s.", m[1], m[2]),
+			Name:     name,
+		}
+	}
+
+	if requestID := h.Get(requestIDHeader); requestID != "" {
+		root := strings.TrimPrefix(requestID, "|")
+		if i := strings.Index(root, "."); i >= 0 {
+			root = root[:i]
+		}
+		if root != "" {
+			return Operation{
+				ID:       root,
+				SpanID:   newSpanID(),
+				ParentID: requestID,
+				Name:     name,
+			}
+		}
+	}
+
+	return NewOperation(name)
+}
+
+// TelemetryID returns the ID of the telemetry that represents the current
+// span, e.g. the request or dependency telemetry.
+func (op Operation) TelemetryID() string {
+	return fmt.Sprintf("|%s.%s.", op.ID, op.SpanID)
+}
+
+// Traceparent returns the W3C traceparent header value of the current
+// span.
+func (op Operation) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", op.ID, op.SpanID)
+}
+
+// Child returns a new span of the operation, with the current span as its
+// parent.
+func (op Operation) Child() Operation {
+	return Operation{
+		ID:       op.ID,
+		SpanID:   newSpanID(),
+		ParentID: op.TelemetryID(),
+		Name:     op.Name,
+	}
+}
+
+// apply sets the operation tags of telemetry that belongs to the current
+// span, i.e. telemetry tracked while handling the request.
+func (op Operation) apply(tags contracts.ContextTags) {
+	tags.Operation().SetId(op.ID)
+	tags.Operation().SetParentId(op.TelemetryID())
+	if op.Name != "" {
+		tags.Operation().SetName(op.Name)
+	}
+}
+
+// WithOperation returns a copy of ctx that carries op.
+func WithOperation(ctx context.Context, op Operation) context.Context {
+	return context.WithValue(ctx, operationContextKey{}, op)
+}
+
+// OperationFromContext returns the operation carried by ctx, if any.
+func OperationFromContext(ctx context.Context) (Operation, bool) {
+	op, ok := ctx.Value(operationContextKey{}).(Operation)
+	return op, ok
+}
+
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("could not generate random id: %v", err))
+	}
+
+	return hex.EncodeToString(b)
+}
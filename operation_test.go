@@ -0,0 +1,87 @@
+package appink8s
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_OperationFromHeaders_Continues_Traceparent(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	op := operationFromHeaders(h, "GET /")
+
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", op.ID)
+	assert.Equal(t, "|0af7651916cd43dd8448eb211c80319c.b7ad6b7169203331.", op.ParentID)
+	assert.Len(t, op.SpanID, 16)
+	assert.NotEqual(t, "b7ad6b7169203331", op.SpanID)
+}
+
+func Test_That_OperationFromHeaders_Continues_Request_ID(t *testing.T) {
+	h := http.Header{}
+	h.Set("Request-Id", "|4bf92f3577b34da6.a3ce929d.")
+
+	op := operationFromHeaders(h, "GET /")
+
+	assert.Equal(t, "4bf92f3577b34da6", op.ID)
+	assert.Equal(t, "|4bf92f3577b34da6.a3ce929d.", op.ParentID)
+}
+
+func Test_That_OperationFromHeaders_Prefers_Traceparent_Over_Request_ID(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.Set("Request-Id", "|4bf92f3577b34da6.a3ce929d.")
+
+	op := operationFromHeaders(h, "GET /")
+
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", op.ID)
+}
+
+func Test_That_OperationFromHeaders_Starts_New_Operation_For_Invalid_Headers(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-00000000000000000000000000000000-b7ad6b7169203331-01")
+
+	op := operationFromHeaders(h, "GET /")
+
+	assert.Len(t, op.ID, 32)
+	assert.NotEqual(t, "00000000000000000000000000000000", op.ID)
+	assert.Empty(t, op.ParentID)
+	assert.Equal(t, "GET /", op.Name)
+}
+
+func Test_That_Operation_Child_Is_Parented_To_Current_Span(t *testing.T) {
+	op := NewOperation("GET /")
+
+	child := op.Child()
+
+	assert.Equal(t, op.ID, child.ID)
+	assert.Equal(t, op.TelemetryID(), child.ParentID)
+	assert.NotEqual(t, op.SpanID, child.SpanID)
+	assert.Equal(t, "00-"+op.ID+"-"+child.SpanID+"-01", child.Traceparent())
+}
+
+func Test_That_Operation_Apply_Sets_Operation_Tags(t *testing.T) {
+	op := NewOperation("GET /")
+	tags := make(contracts.ContextTags)
+
+	op.apply(tags)
+
+	assert.Equal(t, op.ID, tags.Operation().GetId())
+	assert.Equal(t, op.TelemetryID(), tags.Operation().GetParentId())
+	assert.Equal(t, "GET /", tags.Operation().GetName())
+}
+
+func Test_That_OperationFromContext_Returns_Operation_Of_Context(t *testing.T) {
+	op := NewOperation("GET /")
+
+	_, ok := OperationFromContext(context.Background())
+	actual, found := OperationFromContext(WithOperation(context.Background(), op))
+
+	assert.False(t, ok)
+	assert.True(t, found)
+	assert.Equal(t, op, actual)
+}
@@ -0,0 +1,348 @@
+package appink8s
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const defaultRequestTimeout = 30 * time.Second
+const defaultFileWatchInterval = 10 * time.Second
+const nodeNameEnvironmentVariable = "NODE_NAME"
+const podIPEnvironmentVariable = "POD_IP"
+
+// Option configures a telemetry client created by NewTelemetryClientWithOptions.
+type Option func(*options)
+
+type options struct {
+	ctx             context.Context
+	host            string
+	root            string
+	tokenPath       string
+	namespacePath   string
+	certPath        string
+	cgroupPath      string
+	requestTimeout  time.Duration
+	httpClient      *http.Client
+	roundTripper    http.RoundTripper
+	telemetryConfig *appinsights.TelemetryConfiguration
+	watchInterval   time.Duration
+	useKubeconfig   bool
+	kubeconfig      string
+	podNamespace    string
+	podName         string
+	nodeName        string
+	podIP           string
+	pageSize        int
+	limiter         *ratelimiter
+	startupJitter   time.Duration
+	trackAPICalls   bool
+	forwardEvents   bool
+	metricsInterval time.Duration
+	clusterDomain   string
+	targetWorkloads bool
+	sourcePods      bool
+	sourceCluster   bool
+	processors      []TelemetryProcessor
+	aggregateEvery  time.Duration
+	heartbeatEvery  time.Duration
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		ctx:            context.Background(),
+		host:           inClusterHostAddress(),
+		tokenPath:      k8sTokenPath,
+		namespacePath:  k8sNamespacePath,
+		certPath:       k8sCertPath,
+		cgroupPath:     k8sContainerInfoPath,
+		requestTimeout: defaultRequestTimeout,
+		watchInterval:  defaultFileWatchInterval,
+		nodeName:       os.Getenv(nodeNameEnvironmentVariable),
+		podIP:          os.Getenv(podIPEnvironmentVariable),
+		pageSize:       defaultPageSize,
+		limiter:        sharedRateLimiter,
+		clusterDomain:  defaultClusterDomain,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+func (o *options) TelemetryConfiguration(iKey string) *appinsights.TelemetryConfiguration {
+	if o.telemetryConfig == nil {
+		return appinsights.NewTelemetryConfiguration(iKey)
+	}
+
+	cfg := *o.telemetryConfig
+	if iKey != "" {
+		cfg.InstrumentationKey = iKey
+	}
+
+	return &cfg
+}
+
+// WithKubernetesHost sets the address of the Kubernetes API server,
+// e.g. https://kubernetes.default.svc. It defaults to the address in
+// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT.
+func WithKubernetesHost(address string) Option {
+	return func(o *options) {
+		o.host = address
+	}
+}
+
+// WithFileSystemRoot sets a directory that all service account and
+// cgroup paths are resolved relative to.
+func WithFileSystemRoot(root string) Option {
+	return func(o *options) {
+		o.root = root
+	}
+}
+
+// WithTokenPath sets the path of the service account token file.
+func WithTokenPath(path string) Option {
+	return func(o *options) {
+		o.tokenPath = path
+	}
+}
+
+// WithNamespacePath sets the path of the service account namespace file.
+func WithNamespacePath(path string) Option {
+	return func(o *options) {
+		o.namespacePath = path
+	}
+}
+
+// WithCertificatePath sets the path of the Kubernetes API CA certificate.
+func WithCertificatePath(path string) Option {
+	return func(o *options) {
+		o.certPath = path
+	}
+}
+
+// WithCGroupPath sets the path of the cgroup file used to find the
+// current container ID.
+func WithCGroupPath(path string) Option {
+	return func(o *options) {
+		o.cgroupPath = path
+	}
+}
+
+// WithRequestTimeout sets the timeout for each Kubernetes API request.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for Kubernetes API requests.
+// The client is used as is, so the CA certificate file is not read.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithRoundTripper sets the transport used for Kubernetes API requests.
+// The transport is used as is, so the CA certificate file is not read.
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.roundTripper = rt
+	}
+}
+
+// WithTelemetryConfiguration sets the configuration used to create the
+// underlying Application Insights client. A non-empty instrumentation
+// key passed to the constructor takes precedence over the one in cfg.
+func WithTelemetryConfiguration(cfg *appinsights.TelemetryConfiguration) Option {
+	return func(o *options) {
+		o.telemetryConfig = cfg
+	}
+}
+
+// WithContext sets a context that stops all background work of the
+// client, such as file watching, when it is done.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithFileWatchInterval sets how often a file passed to
+// NewTelemetryClientFromFile is checked for changes.
+func WithFileWatchInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.watchInterval = interval
+	}
+}
+
+// WithKubeconfig enables running outside the cluster by reading the API
+// server address and credentials from the current context of a kubeconfig
+// file. An empty path falls back to $KUBECONFIG and ~/.kube/config. Use
+// WithPod to select the pod whose metadata is reported.
+func WithKubeconfig(path string) Option {
+	return func(o *options) {
+		o.useKubeconfig = true
+		o.kubeconfig = path
+	}
+}
+
+// WithPod sets the namespace and name of the pod to report metadata for
+// when running outside the cluster. An empty namespace falls back to the
+// namespace of the kubeconfig context.
+func WithPod(namespace, name string) Option {
+	return func(o *options) {
+		o.podNamespace = namespace
+		o.podName = name
+	}
+}
+
+// WithNodeName sets the name of the node the pod runs on, which narrows
+// down pod listings. It defaults to the NODE_NAME environment variable,
+// typically set from spec.nodeName with the Downward API.
+func WithNodeName(name string) Option {
+	return func(o *options) {
+		o.nodeName = name
+	}
+}
+
+// WithPodIP sets the IP of the pod, which narrows down pod listings to the
+// pod itself. It defaults to the POD_IP environment variable, typically
+// set from status.podIP with the Downward API.
+func WithPodIP(ip string) Option {
+	return func(o *options) {
+		o.podIP = ip
+	}
+}
+
+// WithPageSize sets the maximum number of items requested per page when
+// listing from the Kubernetes API.
+func WithPageSize(size int) Option {
+	return func(o *options) {
+		o.pageSize = size
+	}
+}
+
+// WithRateLimit limits the Kubernetes API requests of the client to qps
+// requests per second, with bursts of up to burst requests. By default all
+// clients share a limit of 5 requests per second with bursts of 10. A qps
+// of zero disables rate limiting.
+func WithRateLimit(qps float64, burst int) Option {
+	return func(o *options) {
+		o.limiter = newRateLimiter(qps, burst)
+	}
+}
+
+// WithStartupJitter delays the first Kubernetes API discovery by a random
+// duration of up to max, to spread out the requests of large rollouts.
+// Discovery then runs in the background, and telemetry tracked before it
+// completes is sent without Kubernetes properties.
+func WithStartupJitter(max time.Duration) Option {
+	return func(o *options) {
+		o.startupJitter = max
+	}
+}
+
+// WithAPIDependencyTracking tracks every request the client makes to the
+// Kubernetes API as dependency telemetry of type "Kubernetes API".
+func WithAPIDependencyTracking() Option {
+	return func(o *options) {
+		o.trackAPICalls = true
+	}
+}
+
+// WithEventForwarding watches the Kubernetes events about the current pod,
+// such as failed probes, OOM kills and evictions, and tracks them as
+// traces with the Kubernetes properties. Warning events are tracked with
+// Warning severity.
+func WithEventForwarding() Option {
+	return func(o *options) {
+		o.forwardEvents = true
+	}
+}
+
+// WithResourceMetrics reads the memory and CPU usage of the current
+// container from its cgroup files every interval, and tracks them as
+// metrics with the Kubernetes properties. Both cgroup v1 and v2 are
+// supported.
+func WithResourceMetrics(interval time.Duration) Option {
+	return func(o *options) {
+		o.metricsInterval = interval
+	}
+}
+
+// WithClusterDomain sets the DNS domain of the cluster, which is used to
+// recognize dependency targets such as orders.shop.svc.cluster.local as
+// Kubernetes Services. The default is cluster.local.
+func WithClusterDomain(domain string) Option {
+	return func(o *options) {
+		o.clusterDomain = domain
+	}
+}
+
+// WithTargetWorkloadResolution looks up the workload behind the Service of
+// in-cluster dependency targets, and adds it to the dependencies as the
+// Kubernetes.Target.Workload property. This requires get on services and
+// list on pods in the namespace of the target.
+func WithTargetWorkloadResolution() Option {
+	return func(o *options) {
+		o.targetWorkloads = true
+	}
+}
+
+// WithSourceIdentification keeps an index of the pods in the current
+// namespace by IP, and adds the pod, workload and namespace that made a
+// request to request telemetry as the Kubernetes.Source.Pod,
+// Kubernetes.Source.Workload and Kubernetes.Source.Namespace properties.
+// This requires list and watch on pods in the namespace.
+func WithSourceIdentification() Option {
+	return func(o *options) {
+		o.sourcePods = true
+	}
+}
+
+// WithClusterWideSourceIdentification is like WithSourceIdentification,
+// but indexes the pods of all namespaces. This requires list and watch on
+// pods in the whole cluster.
+func WithClusterWideSourceIdentification() Option {
+	return func(o *options) {
+		o.sourcePods = true
+		o.sourceCluster = true
+	}
+}
+
+// WithTelemetryProcessor adds p to the end of the chain of processors that
+// telemetry runs through before it is sent. Processors run in the order
+// they are added, and the Kubernetes properties are added before the first
+// unless KubernetesEnrichment is added as well.
+func WithTelemetryProcessor(p TelemetryProcessor) Option {
+	return func(o *options) {
+		o.processors = append(o.processors, p)
+	}
+}
+
+// WithMetricAggregation aggregates tracked metrics per name and properties
+// over interval, and sends their count, sum, minimum, maximum and standard
+// deviation as one aggregate metric per interval. The Kubernetes properties
+// are added to the aggregates when they are sent.
+func WithMetricAggregation(interval time.Duration) Option {
+	return func(o *options) {
+		o.aggregateEvery = interval
+	}
+}
+
+// WithHeartbeat tracks a HeartbeatState metric on startup and every
+// interval after, with the Kubernetes properties of the pod, the restart
+// count of the container, the uptime of the process and whether the
+// Kubernetes properties could be read. Heartbeats are never aggregated.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatEvery = interval
+	}
+}
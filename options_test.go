@@ -0,0 +1,135 @@
+package appink8s
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_That_NewOptions_Uses_InCluster_Defaults(t *testing.T) {
+	os.Unsetenv(k8sServiceHostEnvironmentVariable)
+	o := newOptions()
+
+	assert.Equal(t, k8sHostAddress, o.host)
+	assert.Equal(t, k8sTokenPath, o.tokenPath)
+	assert.Equal(t, k8sNamespacePath, o.namespacePath)
+	assert.Equal(t, k8sCertPath, o.certPath)
+	assert.Equal(t, k8sContainerInfoPath, o.cgroupPath)
+	assert.Equal(t, defaultRequestTimeout, o.requestTimeout)
+}
+
+func Test_That_NewOptions_Applies_Options_In_Order(t *testing.T) {
+	o := newOptions(
+		WithKubernetesHost("https://first"),
+		WithKubernetesHost("https://second"),
+		WithRequestTimeout(5*time.Second),
+	)
+
+	assert.Equal(t, "https://second", o.host)
+	assert.Equal(t, 5*time.Second, o.requestTimeout)
+}
+
+func Test_That_TelemetryConfiguration_Prefers_Constructor_Instrumentation_Key(t *testing.T) {
+	cfg := appinsights.NewTelemetryConfiguration("config-key")
+	cfg.EndpointUrl = "http://localhost/v2/track"
+	o := newOptions(WithTelemetryConfiguration(cfg))
+
+	result := o.TelemetryConfiguration("constructor-key")
+
+	assert.Equal(t, "constructor-key", result.InstrumentationKey)
+	assert.Equal(t, cfg.EndpointUrl, result.EndpointUrl)
+	assert.Equal(t, "config-key", cfg.InstrumentationKey)
+}
+
+func Test_That_NewTelemetryClientWithOptions_Deactivates_Enrichment_Outside_Kubernetes(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+
+	c := NewTelemetryClientWithOptions("key", WithFileSystemRoot(root))
+
+	ktc, ok := c.(*kubernetesTelemetryClient)
+	assert.True(t, ok)
+	assert.False(t, ktc.active)
+	assert.Equal(t, ErrNotInCluster, EnrichmentError(c))
+}
+
+func Test_That_NewTelemetryClientWithOptions_Keeps_Client_Configuration_Error(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+
+	c := NewTelemetryClientWithOptions("key", WithKubeconfig(filepath.Join(root, "missing")))
+
+	err := EnrichmentError(c)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotInCluster, err)
+}
+
+func Test_That_NewTelemetryClientWithOptions_Reads_Spec_From_Configured_Server(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestCluster(t, root)
+
+	srv := newOptionsTestServer(k8sPodResponse)
+	defer srv.Close()
+
+	c := NewTelemetryClientWithOptions("key",
+		WithFileSystemRoot(root),
+		WithKubernetesHost(srv.URL),
+		WithHTTPClient(srv.Client()),
+	)
+
+	ktc, ok := c.(*kubernetesTelemetryClient)
+	assert.True(t, ok)
+
+	spec, err := ktc.initializer.ReadPropertySpec()
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST-POD-NAME", spec.PodName)
+	assert.Equal(t, "TEST-NODE-NAME", spec.NodeName)
+}
+
+func newOptionsTestRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "appink8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+// writeOptionsTestCluster writes the service account and cgroup files of a
+// container in a pod of newOptionsTestServer.
+func writeOptionsTestCluster(t *testing.T, root string) {
+	writeOptionsTestFile(t, root, k8sTokenPath, "token")
+	writeOptionsTestFile(t, root, k8sNamespacePath, "default")
+	writeOptionsTestFile(t, root, k8sContainerInfoPath, "4:cpu,cpuacct:/kubepods/besteffort/pod-id/TEST-CONTAINER-ID")
+}
+
+// newOptionsTestServer serves the test node, and pods for any other path.
+func newOptionsTestServer(pods string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/nodes/") {
+			w.Write([]byte(k8sNodeResponse))
+			return
+		}
+
+		w.Write([]byte(pods))
+	}))
+}
+
+func writeOptionsTestFile(t *testing.T, root, path, content string) {
+	p := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
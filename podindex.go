@@ -0,0 +1,177 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+type podwatcher interface {
+	CurrentNamespace() (string, error)
+	ListPods(namespace string) (*podListSpec, error)
+	WatchPods(ctx context.Context, namespace, resourceVersion string, onEvent func(string, podSpec)) error
+}
+
+type podSource struct {
+	ID        string
+	Pod       string
+	Workload  string
+	Namespace string
+}
+
+// podindex maps pod IPs to the pods and workloads that own them, in the
+// current namespace or in the whole cluster. The index is listed once and
+// kept up to date with a watch, which is restarted from a new listing when
+// its resource version has expired.
+type podindex struct {
+	watcher     podwatcher
+	clusterWide bool
+	lock        sync.RWMutex
+	pods        map[string]podSource
+}
+
+func newPodIndex(w podwatcher, clusterWide bool) *podindex {
+	return &podindex{
+		watcher:     w,
+		clusterWide: clusterWide,
+		pods:        make(map[string]podSource),
+	}
+}
+
+// Run keeps the index up to date until ctx is done.
+func (pi *podindex) Run(ctx context.Context) {
+	namespace := ""
+	if !pi.clusterWide {
+		ns, err := pi.watcher.CurrentNamespace()
+		if err != nil {
+			return
+		}
+		namespace = ns
+	}
+
+	resourceVersion := ""
+	retry := minWatchRetryInterval
+
+	for ctx.Err() == nil {
+		var err error
+		if resourceVersion == "" {
+			resourceVersion, err = pi.list(namespace)
+		}
+		if err == nil {
+			err = pi.watcher.WatchPods(ctx, namespace, resourceVersion, func(kind string, pod podSpec) {
+				resourceVersion = pod.MetaData.ResourceVersion
+				retry = minWatchRetryInterval
+				pi.handle(kind, pod)
+			})
+		}
+
+		var statusErr *APIStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone {
+			resourceVersion = ""
+			continue
+		}
+		if err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if retry *= 2; retry > maxWatchRetryInterval {
+			retry = maxWatchRetryInterval
+		}
+	}
+}
+
+func (pi *podindex) list(namespace string) (string, error) {
+	pods, err := pi.watcher.ListPods(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	index := make(map[string]podSource)
+	for _, pod := range pods.List {
+		if isIndexedPod(pod) {
+			index[pod.Status.PodIP] = newPodSource(pod)
+		}
+	}
+
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+
+	pi.pods = index
+	return pods.MetaData.ResourceVersion, nil
+}
+
+func (pi *podindex) handle(kind string, pod podSpec) {
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+
+	ip := pod.Status.PodIP
+	if kind != "DELETED" && isIndexedPod(pod) {
+		pi.pods[ip] = newPodSource(pod)
+		return
+	}
+
+	// Pod IPs are reused, so only the entry of this pod is removed.
+	if source, ok := pi.pods[ip]; ok && source.ID == pod.MetaData.ID {
+		delete(pi.pods, ip)
+	}
+}
+
+// Lookup returns the pod with the given IP.
+func (pi *podindex) Lookup(ip string) (podSource, bool) {
+	pi.lock.RLock()
+	defer pi.lock.RUnlock()
+
+	source, ok := pi.pods[ip]
+	return source, ok
+}
+
+// apply adds the pod that made a request, identified by the client IP of
+// the request telemetry.
+func (pi *podindex) apply(t *appinsights.RequestTelemetry) {
+	ip := t.Tags.Location().GetIp()
+	if ip == "" {
+		return
+	}
+
+	source, ok := pi.Lookup(ip)
+	if !ok {
+		return
+	}
+
+	t.Properties["Kubernetes.Source.Pod"] = source.Pod
+	t.Properties["Kubernetes.Source.Namespace"] = source.Namespace
+	if source.Workload != "" {
+		t.Properties["Kubernetes.Source.Workload"] = source.Workload
+	}
+}
+
+// isIndexedPod reports whether the IP of pod identifies it. Pods on the
+// host network share the IP of their node, and the IPs of finished pods
+// may already be reused.
+func isIndexedPod(pod podSpec) bool {
+	if pod.Status.PodIP == "" || pod.RuntimeSpec.HostNetwork {
+		return false
+	}
+
+	return pod.Status.Phase != "Succeeded" && pod.Status.Phase != "Failed"
+}
+
+func newPodSource(pod podSpec) podSource {
+	return podSource{
+		ID:        pod.MetaData.ID,
+		Pod:       pod.MetaData.Name,
+		Workload:  pod.FindWorkloadName(),
+		Namespace: pod.MetaData.Namespace,
+	}
+}
@@ -0,0 +1,157 @@
+package appink8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+type podindex_mockWatcher struct {
+	cancel           context.CancelFunc
+	lists            []*podListSpec
+	namespaces       []string
+	resourceVersions []string
+	calls            []func(func(string, podSpec)) error
+}
+
+func (m *podindex_mockWatcher) CurrentNamespace() (string, error) {
+	return "shop", nil
+}
+
+func (m *podindex_mockWatcher) ListPods(namespace string) (*podListSpec, error) {
+	m.namespaces = append(m.namespaces, namespace)
+	list := m.lists[0]
+	m.lists = m.lists[1:]
+	return list, nil
+}
+
+func (m *podindex_mockWatcher) WatchPods(ctx context.Context, namespace, resourceVersion string, onEvent func(string, podSpec)) error {
+	m.resourceVersions = append(m.resourceVersions, resourceVersion)
+
+	if len(m.calls) == 0 {
+		m.cancel()
+		return ctx.Err()
+	}
+
+	call := m.calls[0]
+	m.calls = m.calls[1:]
+	return call(onEvent)
+}
+
+func newPodIndexTestPod(uid, name, ip, resourceVersion string) podSpec {
+	return podSpec{
+		MetaData: metaDataSpec{
+			ID:              uid,
+			Name:            name,
+			Namespace:       "shop",
+			ResourceVersion: resourceVersion,
+			Owners:          []podOwnerSpec{{Kind: "ReplicaSet", Name: "checkout-7d9c6b5f4"}},
+		},
+		Status: podStatusSpec{
+			Phase: "Running",
+			PodIP: ip,
+		},
+	}
+}
+
+func Test_That_Run_Lists_And_Watches_Pods_Of_Current_Namespace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &podindex_mockWatcher{
+		cancel: cancel,
+		lists: []*podListSpec{{
+			MetaData: listMetaDataSpec{ResourceVersion: "5"},
+			List:     []podSpec{newPodIndexTestPod("1", "checkout-1", "10.1.0.5", "4")},
+		}},
+		calls: []func(func(string, podSpec)) error{
+			func(onEvent func(string, podSpec)) error {
+				onEvent("ADDED", newPodIndexTestPod("2", "checkout-2", "10.1.0.6", "6"))
+				return nil
+			},
+		},
+	}
+	pi := newPodIndex(w, false)
+
+	pi.Run(ctx)
+
+	assert.Equal(t, []string{"shop"}, w.namespaces)
+	assert.Equal(t, []string{"5", "6"}, w.resourceVersions)
+	source, ok := pi.Lookup("10.1.0.6")
+	assert.True(t, ok)
+	assert.Equal(t, podSource{ID: "2", Pod: "checkout-2", Workload: "checkout", Namespace: "shop"}, source)
+}
+
+func Test_That_Run_Lists_Pods_Again_When_Watch_Is_Gone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &podindex_mockWatcher{
+		cancel: cancel,
+		lists: []*podListSpec{
+			{MetaData: listMetaDataSpec{ResourceVersion: "5"}},
+			{MetaData: listMetaDataSpec{ResourceVersion: "9"}},
+		},
+		calls: []func(func(string, podSpec)) error{
+			func(onEvent func(string, podSpec)) error {
+				return &APIStatusError{StatusCode: 410}
+			},
+		},
+	}
+	pi := newPodIndex(w, true)
+
+	pi.Run(ctx)
+
+	assert.Equal(t, []string{"", ""}, w.namespaces)
+	assert.Equal(t, []string{"5", "9"}, w.resourceVersions)
+}
+
+func Test_That_Handle_Removes_Deleted_And_Finished_Pods(t *testing.T) {
+	pi := newPodIndex(nil, false)
+
+	pi.handle("ADDED", newPodIndexTestPod("1", "checkout-1", "10.1.0.5", "1"))
+	pi.handle("ADDED", newPodIndexTestPod("2", "checkout-2", "10.1.0.6", "2"))
+	finished := newPodIndexTestPod("2", "checkout-2", "10.1.0.6", "3")
+	finished.Status.Phase = "Succeeded"
+	pi.handle("MODIFIED", finished)
+	pi.handle("DELETED", newPodIndexTestPod("1", "checkout-1", "10.1.0.5", "4"))
+
+	assert.Empty(t, pi.pods)
+}
+
+func Test_That_Handle_Keeps_Reused_IP_Of_Other_Pod(t *testing.T) {
+	pi := newPodIndex(nil, false)
+
+	pi.handle("ADDED", newPodIndexTestPod("2", "checkout-2", "10.1.0.5", "2"))
+	pi.handle("DELETED", newPodIndexTestPod("1", "checkout-1", "10.1.0.5", "3"))
+
+	source, ok := pi.Lookup("10.1.0.5")
+	assert.True(t, ok)
+	assert.Equal(t, "checkout-2", source.Pod)
+}
+
+func Test_That_Handle_Skips_Host_Network_Pods(t *testing.T) {
+	pi := newPodIndex(nil, false)
+	pod := newPodIndexTestPod("1", "node-exporter", "10.0.0.4", "1")
+	pod.RuntimeSpec.HostNetwork = true
+
+	pi.handle("ADDED", pod)
+
+	assert.Empty(t, pi.pods)
+}
+
+func Test_That_Apply_Adds_Source_Pod_To_Request_Telemetry(t *testing.T) {
+	pi := newPodIndex(nil, false)
+	pi.handle("ADDED", newPodIndexTestPod("1", "checkout-1", "10.1.0.5", "1"))
+
+	request := appinsights.NewRequestTelemetry("GET", "/", time.Second, "200")
+	request.Tags.Location().SetIp("10.1.0.5")
+	pi.apply(request)
+
+	assert.Equal(t, "checkout-1", request.Properties["Kubernetes.Source.Pod"])
+	assert.Equal(t, "checkout", request.Properties["Kubernetes.Source.Workload"])
+	assert.Equal(t, "shop", request.Properties["Kubernetes.Source.Namespace"])
+}
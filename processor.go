@@ -0,0 +1,87 @@
+package appink8s
+
+import (
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// TelemetryProcessor processes telemetry before it is sent, e.g. to add
+// properties, rewrite URLs or drop items. Process returns false to drop
+// the item, in which case later processors do not see it.
+type TelemetryProcessor interface {
+	Process(t appinsights.Telemetry) bool
+}
+
+// TelemetryProcessorFunc is a function that is a TelemetryProcessor.
+type TelemetryProcessorFunc func(t appinsights.Telemetry) bool
+
+// Process calls f(t).
+func (f TelemetryProcessorFunc) Process(t appinsights.Telemetry) bool {
+	return f(t)
+}
+
+// KubernetesEnrichment is the processor that adds the Kubernetes
+// properties. It runs first unless it is placed in the chain with
+// WithTelemetryProcessor, e.g. after a processor that drops health checks
+// before the Kubernetes properties are read.
+var KubernetesEnrichment TelemetryProcessor = enrichmentProcessor{}
+
+// enrichmentProcessor marks the position of the Kubernetes enrichment in
+// the chain. The enrichment itself is done by the client that runs the
+// chain.
+type enrichmentProcessor struct{}
+
+func (enrichmentProcessor) Process(appinsights.Telemetry) bool {
+	return true
+}
+
+// samplingProcessor is implemented by processors that sample telemetry.
+// The sample rate of a kept item is returned to the client that runs the
+// chain rather than stored on the item, so that it only ends up on the
+// envelope.
+type samplingProcessor interface {
+	sample(t appinsights.Telemetry) (bool, float64)
+}
+
+// processTelemetry runs t through the chain of processors, with enrich in
+// place of KubernetesEnrichment, or first when it is not in the chain. It
+// returns false when a processor dropped t, and the percentage of items
+// like t that the samplers in the chain kept.
+func processTelemetry(t appinsights.Telemetry, processors []TelemetryProcessor, enrich func(appinsights.Telemetry)) (bool, float64) {
+	if !hasEnrichmentProcessor(processors) {
+		enrich(t)
+	}
+
+	rate := 100.0
+	for _, p := range processors {
+		if p == KubernetesEnrichment {
+			enrich(t)
+			continue
+		}
+
+		if s, ok := p.(samplingProcessor); ok {
+			keep, percentage := s.sample(t)
+			if !keep {
+				return false, 0
+			}
+
+			rate = rate * percentage / 100
+			continue
+		}
+
+		if !p.Process(t) {
+			return false, 0
+		}
+	}
+
+	return true, rate
+}
+
+func hasEnrichmentProcessor(processors []TelemetryProcessor) bool {
+	for _, p := range processors {
+		if p == KubernetesEnrichment {
+			return true
+		}
+	}
+
+	return false
+}
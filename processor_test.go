@@ -0,0 +1,132 @@
+package appink8s
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProcessorTestClient(processors ...TelemetryProcessor) (*kubernetesTelemetryClient, *middleware_mockTelemetryClient) {
+	m := &middleware_mockTelemetryClient{
+		mockTelemetryClient: mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initializer:     &mockInitializer{spec: newSpec()},
+		processors:      processors,
+	}
+
+	return c, m
+}
+
+func Test_That_Track_Runs_Processors_In_Order_After_Enrichment(t *testing.T) {
+	var order []string
+	c, m := newProcessorTestClient(
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			order = append(order, "first:"+t.GetProperties()["Kubernetes.Pod.Name"])
+			return true
+		}),
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			order = append(order, "second")
+			return true
+		}),
+	)
+
+	c.TrackEvent("test")
+
+	assert.Equal(t, []string{"first:pod-name", "second"}, order)
+	assert.Len(t, m.items, 1)
+}
+
+func Test_That_Track_Drops_Telemetry_Vetoed_By_Processor(t *testing.T) {
+	called := false
+	c, m := newProcessorTestClient(
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			request, ok := t.(*appinsights.RequestTelemetry)
+			return !ok || request.Url != "/healthz"
+		}),
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			called = true
+			return true
+		}),
+	)
+
+	c.TrackRequest("GET", "/healthz", time.Millisecond, "200")
+
+	assert.Empty(t, m.items)
+	assert.False(t, called)
+}
+
+func Test_That_Track_Runs_Enrichment_At_Its_Place_In_Chain(t *testing.T) {
+	var podName string
+	i := &mockInitializer{spec: newSpec()}
+	c, m := newProcessorTestClient(
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			podName = t.GetProperties()["Kubernetes.Pod.Name"]
+			return false
+		}),
+		KubernetesEnrichment,
+	)
+	c.initializer = i
+
+	c.TrackEvent("test")
+
+	assert.Empty(t, podName)
+	assert.Empty(t, m.items)
+	assert.Equal(t, 0, i.called)
+}
+
+func Test_That_TrackInternal_Runs_Processors_That_May_Drop_Telemetry(t *testing.T) {
+	c, m := newProcessorTestClient(TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+		return false
+	}))
+
+	c.trackInternal(appinsights.NewEventTelemetry("internal"))
+
+	assert.Empty(t, m.items)
+}
+
+func Test_That_TrackInternal_Skips_Enrichment_In_Processor_Chain(t *testing.T) {
+	var podName string
+	i := &mockInitializer{spec: newSpec()}
+	c, m := newProcessorTestClient(
+		KubernetesEnrichment,
+		TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			podName = t.GetProperties()["Kubernetes.Pod.Name"]
+			return true
+		}),
+	)
+	c.initializer = i
+
+	c.trackInternal(appinsights.NewEventTelemetry("internal"))
+
+	assert.Len(t, m.items, 1)
+	assert.Empty(t, podName)
+	assert.Equal(t, 0, i.called)
+}
+
+func Test_That_NewTelemetryClient_Runs_Processors_Outside_Kubernetes(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	m := &middleware_mockTelemetryClient{}
+	processed := false
+
+	c := newTelemetryClient(m, newOptions(
+		WithFileSystemRoot(root),
+		WithTelemetryProcessor(TelemetryProcessorFunc(func(t appinsights.Telemetry) bool {
+			processed = true
+			return true
+		})),
+	))
+	c.TrackEvent("test")
+
+	assert.True(t, processed)
+	assert.Len(t, m.items, 1)
+	assert.Equal(t, ErrNotInCluster, EnrichmentError(c))
+}
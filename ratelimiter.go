@@ -0,0 +1,79 @@
+package appink8s
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultRateLimitQPS = 5
+const defaultRateLimitBurst = 10
+
+// sharedRateLimiter limits the Kubernetes API requests of all clients in
+// the process that are not configured with a rate limit of their own.
+var sharedRateLimiter = newRateLimiter(defaultRateLimitQPS, defaultRateLimitBurst)
+
+// ratelimiter is a token bucket that allows bursts of up to burst requests,
+// refilled at qps tokens per second.
+type ratelimiter struct {
+	lock   sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(qps float64, burst int) *ratelimiter {
+	return &ratelimiter{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// Reserve takes a token from the bucket and returns how long to wait
+// before it may be used. Tokens are reserved ahead of time, so concurrent
+// callers wait in line rather than all at once.
+func (r *ratelimiter) Reserve() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.qps
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-r.tokens / r.qps * float64(time.Second))
+}
+
+func (r *ratelimiter) Wait(ctx context.Context) error {
+	if r.qps <= 0 {
+		return nil
+	}
+
+	delay := r.Reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,79 @@
+package appink8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(qps float64, burst int, now *time.Time) *ratelimiter {
+	r := newRateLimiter(qps, burst)
+	r.now = func() time.Time {
+		return *now
+	}
+
+	return r
+}
+
+func Test_That_Reserve_Allows_Burst_Without_Delay(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newTestRateLimiter(1, 3, &now)
+
+	assert.Equal(t, time.Duration(0), r.Reserve())
+	assert.Equal(t, time.Duration(0), r.Reserve())
+	assert.Equal(t, time.Duration(0), r.Reserve())
+}
+
+func Test_That_Reserve_Delays_Requests_Beyond_Burst(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newTestRateLimiter(2, 1, &now)
+
+	assert.Equal(t, time.Duration(0), r.Reserve())
+	assert.Equal(t, 500*time.Millisecond, r.Reserve())
+	assert.Equal(t, time.Second, r.Reserve())
+}
+
+func Test_That_Reserve_Refills_Tokens_Over_Time(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newTestRateLimiter(1, 1, &now)
+
+	r.Reserve()
+	now = now.Add(time.Second)
+
+	assert.Equal(t, time.Duration(0), r.Reserve())
+}
+
+func Test_That_Reserve_Does_Not_Refill_Beyond_Burst(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newTestRateLimiter(1, 1, &now)
+
+	r.Reserve()
+	now = now.Add(time.Hour)
+
+	assert.Equal(t, time.Duration(0), r.Reserve())
+	assert.Equal(t, time.Second, r.Reserve())
+}
+
+func Test_That_Wait_Returns_Context_Error_When_Cancelled(t *testing.T) {
+	r := newRateLimiter(0.001, 1)
+	r.Reserve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, r.Wait(ctx))
+}
+
+func Test_That_Wait_Is_Disabled_With_Zero_QPS(t *testing.T) {
+	r := newRateLimiter(0, 0)
+
+	assert.NoError(t, r.Wait(context.Background()))
+	assert.NoError(t, r.Wait(context.Background()))
+}
+
+func Test_That_NewOptions_Shares_Rate_Limiter_Between_Clients(t *testing.T) {
+	assert.Same(t, newOptions().limiter, newOptions().limiter)
+	assert.False(t, sharedRateLimiter == newOptions(WithRateLimit(1, 1)).limiter)
+}
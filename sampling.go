@@ -0,0 +1,293 @@
+package appink8s
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+const defaultSamplingInterval = 15 * time.Second
+const minSamplingPercentage = 0.1
+
+// TelemetryType identifies a type of telemetry, which is sampled at a rate
+// of its own.
+type TelemetryType string
+
+// Telemetry types that are sampled. Metrics are never sampled, since they
+// are usually pre-aggregated.
+const (
+	RequestType      TelemetryType = "Request"
+	DependencyType   TelemetryType = "Dependency"
+	EventType        TelemetryType = "Event"
+	TraceType        TelemetryType = "Trace"
+	ExceptionType    TelemetryType = "Exception"
+	AvailabilityType TelemetryType = "Availability"
+	PageViewType     TelemetryType = "PageView"
+	metricType       TelemetryType = "Metric"
+)
+
+// SamplingOption configures a sampler created by NewFixedRateSampler or
+// NewAdaptiveSampler.
+type SamplingOption func(*sampler)
+
+// sampler keeps or drops telemetry by a score computed from its operation
+// ID, so that all telemetry of an operation is kept or dropped together.
+// Items of types sampled at a higher percentage are kept whenever items of
+// the same operation at a lower percentage are. Adaptive samplers adjust
+// the percentage of every type each interval, towards a target number of
+// items per second.
+type sampler struct {
+	lock              sync.Mutex
+	percentages       map[TelemetryType]float64
+	defaultPercentage float64
+	adaptive          bool
+	targets           map[TelemetryType]float64
+	defaultTarget     float64
+	counts            map[TelemetryType]int
+	interval          time.Duration
+	windowStart       time.Time
+	now               func() time.Time
+	random            func() float64
+}
+
+// WithTypeSamplingPercentage sets the percentage of items of type typ that
+// a fixed-rate sampler keeps.
+func WithTypeSamplingPercentage(typ TelemetryType, percentage float64) SamplingOption {
+	return func(s *sampler) {
+		s.percentages[typ] = clampPercentage(percentage)
+	}
+}
+
+// WithTypeSamplingTarget sets the number of items of type typ per second
+// that an adaptive sampler aims to keep.
+func WithTypeSamplingTarget(typ TelemetryType, maxItemsPerSecond float64) SamplingOption {
+	return func(s *sampler) {
+		s.targets[typ] = maxItemsPerSecond
+	}
+}
+
+// WithSamplingInterval sets how often an adaptive sampler adjusts its
+// sampling percentages. The default is 15 seconds.
+func WithSamplingInterval(interval time.Duration) SamplingOption {
+	return func(s *sampler) {
+		s.interval = interval
+	}
+}
+
+// NewFixedRateSampler returns a TelemetryProcessor that keeps percentage
+// percent of the operations, e.g. 10 to keep one in ten.
+func NewFixedRateSampler(percentage float64, opts ...SamplingOption) TelemetryProcessor {
+	s := newSampler(opts...)
+	s.defaultPercentage = clampPercentage(percentage)
+
+	return s
+}
+
+// NewAdaptiveSampler returns a TelemetryProcessor that keeps about
+// maxItemsPerSecond items of each type per second, by adjusting the
+// sampling percentage of each type to the rate of items it sees.
+func NewAdaptiveSampler(maxItemsPerSecond float64, opts ...SamplingOption) TelemetryProcessor {
+	s := newSampler(opts...)
+	s.adaptive = true
+	s.defaultTarget = maxItemsPerSecond
+
+	return s
+}
+
+func newSampler(opts ...SamplingOption) *sampler {
+	s := &sampler{
+		percentages:       make(map[TelemetryType]float64),
+		defaultPercentage: 100,
+		targets:           make(map[TelemetryType]float64),
+		counts:            make(map[TelemetryType]int),
+		interval:          defaultSamplingInterval,
+		now:               time.Now,
+		random:            rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *sampler) Process(t appinsights.Telemetry) bool {
+	keep, _ := s.sample(t)
+	return keep
+}
+
+// sample reports whether t is kept, and the percentage of items like t
+// that are kept.
+func (s *sampler) sample(t appinsights.Telemetry) (bool, float64) {
+	typ := telemetryTypeOf(t)
+	if typ == metricType {
+		return true, 100
+	}
+
+	percentage := s.percentage(typ)
+	if percentage >= 100 {
+		return true, 100
+	}
+
+	return s.score(t) < percentage, percentage
+}
+
+// percentage returns the sampling percentage of typ. Adaptive samplers
+// count the item and adjust their percentages when the interval is over.
+func (s *sampler) percentage(typ TelemetryType) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.adaptive {
+		if percentage, ok := s.percentages[typ]; ok {
+			return percentage
+		}
+
+		return s.defaultPercentage
+	}
+
+	now := s.now()
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+
+	s.counts[typ]++
+	if elapsed := now.Sub(s.windowStart); elapsed >= s.interval {
+		s.adjust(elapsed)
+		s.windowStart = now
+	}
+
+	if percentage, ok := s.percentages[typ]; ok {
+		return percentage
+	}
+
+	return 100
+}
+
+// adjust sets the percentage of every type to the share of its items that
+// fits its target, based on the rate of items in the last interval.
+func (s *sampler) adjust(elapsed time.Duration) {
+	percentages := make(map[TelemetryType]float64)
+	for typ, count := range s.counts {
+		target, ok := s.targets[typ]
+		if !ok {
+			target = s.defaultTarget
+		}
+
+		observed := float64(count) / elapsed.Seconds()
+		percentages[typ] = clampPercentage(100 * target / observed)
+	}
+
+	s.percentages = percentages
+	s.counts = make(map[TelemetryType]int)
+}
+
+// score returns a number from 0 to 100 for the operation of t. Items
+// without an operation ID get a random score.
+func (s *sampler) score(t appinsights.Telemetry) float64 {
+	id := t.ContextTags()[contracts.OperationId]
+	if id == "" {
+		return s.random() * 100
+	}
+
+	return samplingScore(id)
+}
+
+// samplingScore hashes id like the other Application Insights SDKs, so
+// that services in different languages sample the same operations.
+func samplingScore(id string) float64 {
+	for len(id) < 8 {
+		id += id
+	}
+
+	hash := int32(5381)
+	for _, c := range id {
+		hash = (hash << 5) + hash + int32(c)
+	}
+
+	return math.Abs(float64(hash)) / float64(math.MaxInt32) * 100
+}
+
+func clampPercentage(percentage float64) float64 {
+	if percentage > 100 {
+		return 100
+	}
+	if percentage < minSamplingPercentage {
+		return minSamplingPercentage
+	}
+
+	return percentage
+}
+
+func telemetryTypeOf(t appinsights.Telemetry) TelemetryType {
+	switch t.(type) {
+	case *appinsights.RequestTelemetry:
+		return RequestType
+	case *appinsights.RemoteDependencyTelemetry:
+		return DependencyType
+	case *appinsights.EventTelemetry:
+		return EventType
+	case *appinsights.TraceTelemetry:
+		return TraceType
+	case *appinsights.ExceptionTelemetry:
+		return ExceptionType
+	case *appinsights.AvailabilityTelemetry:
+		return AvailabilityType
+	case *appinsights.PageViewTelemetry:
+		return PageViewType
+	default:
+		return metricType
+	}
+}
+
+// envelop wraps t in an envelope like the telemetry client does, with the
+// common properties and tags of ctx. The telemetry client does not expose
+// this, and has no way to set the sample rate of an envelope, so this
+// follows TelemetryContext.envelop of the SDK, which a test compares it to.
+func envelop(ctx *appinsights.TelemetryContext, t appinsights.Telemetry, sampleRate float64) *contracts.Envelope {
+	if properties := t.GetProperties(); properties != nil {
+		for k, v := range ctx.CommonProperties {
+			if _, ok := properties[k]; !ok {
+				properties[k] = v
+			}
+		}
+	}
+
+	tdata := t.TelemetryData()
+	data := contracts.NewData()
+	data.BaseType = tdata.BaseType()
+	data.BaseData = tdata
+
+	envelope := contracts.NewEnvelope()
+	envelope.Name = tdata.EnvelopeName(strings.Replace(ctx.InstrumentationKey(), "-", "", -1))
+	envelope.Data = data
+	envelope.IKey = ctx.InstrumentationKey()
+	envelope.SampleRate = sampleRate
+
+	timestamp := t.Time()
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	envelope.Time = timestamp.UTC().Format(time.RFC3339Nano)
+
+	envelope.Tags = make(map[string]string)
+	for k, v := range ctx.Tags {
+		envelope.Tags[k] = v
+	}
+	for k, v := range t.ContextTags() {
+		envelope.Tags[k] = v
+	}
+	if _, ok := envelope.Tags[contracts.OperationId]; !ok {
+		envelope.Tags[contracts.OperationId] = newTraceID()
+	}
+
+	tdata.Sanitize()
+	contracts.SanitizeTags(envelope.Tags)
+
+	return envelope
+}
@@ -0,0 +1,213 @@
+package appink8s
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+type sampling_mockChannel struct {
+	envelopes []*contracts.Envelope
+}
+
+func (m *sampling_mockChannel) EndpointAddress() string { return "" }
+func (m *sampling_mockChannel) Send(e *contracts.Envelope) {
+	m.envelopes = append(m.envelopes, e)
+}
+func (m *sampling_mockChannel) Flush()            {}
+func (m *sampling_mockChannel) Stop()             {}
+func (m *sampling_mockChannel) IsThrottled() bool { return false }
+func (m *sampling_mockChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	return nil
+}
+
+type sampling_mockTelemetryClient struct {
+	middleware_mockTelemetryClient
+	channel *sampling_mockChannel
+}
+
+func (m *sampling_mockTelemetryClient) Channel() appinsights.TelemetryChannel {
+	return m.channel
+}
+
+func newSamplingTestRequest(operationID string) *appinsights.RequestTelemetry {
+	t := appinsights.NewRequestTelemetry("GET", "/", time.Millisecond, "200")
+	t.Tags.Operation().SetId(operationID)
+	return t
+}
+
+func Test_That_SamplingScore_Is_Deterministic_And_In_Range(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("%032x", i*7919)
+		score := samplingScore(id)
+
+		assert.Equal(t, score, samplingScore(id))
+		assert.True(t, score >= 0 && score <= 100, id)
+	}
+}
+
+func Test_That_FixedRateSampler_Keeps_Share_Of_Operations(t *testing.T) {
+	s := NewFixedRateSampler(20)
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		if s.Process(newSamplingTestRequest(newTraceID())) {
+			kept++
+		}
+	}
+
+	assert.InDelta(t, 2000, kept, 300)
+}
+
+func Test_That_FixedRateSampler_Keeps_Operations_Together(t *testing.T) {
+	s := NewFixedRateSampler(50, WithTypeSamplingPercentage(DependencyType, 50))
+
+	for i := 0; i < 100; i++ {
+		op := NewOperation("")
+		request := newSamplingTestRequest(op.ID)
+		dependency := appinsights.NewRemoteDependencyTelemetry("GET /", "HTTP", "orders", true)
+		dependency.Tags.Operation().SetId(op.ID)
+
+		assert.Equal(t, s.Process(request), s.Process(dependency))
+	}
+}
+
+func Test_That_FixedRateSampler_Sets_Sample_Rate_Per_Type(t *testing.T) {
+	s := NewFixedRateSampler(100, WithTypeSamplingPercentage(RequestType, 100), WithTypeSamplingPercentage(TraceType, 99.9))
+
+	request := newSamplingTestRequest("0")
+	trace := appinsights.NewTraceTelemetry("message", contracts.Information)
+	trace.Tags.Operation().SetId("0")
+
+	keep, rate := s.(*sampler).sample(request)
+	assert.True(t, keep)
+	assert.Equal(t, 100.0, rate)
+
+	keep, rate = s.(*sampler).sample(trace)
+	assert.True(t, keep)
+	assert.Equal(t, 99.9, rate)
+}
+
+func Test_That_Sampler_Leaves_Telemetry_Properties_Untouched(t *testing.T) {
+	s := NewFixedRateSampler(99.9)
+	request := newSamplingTestRequest("0")
+
+	assert.True(t, s.Process(request))
+	assert.Empty(t, request.Properties)
+}
+
+func Test_That_ProcessTelemetry_Combines_Rates_Of_Chained_Samplers(t *testing.T) {
+	processors := []TelemetryProcessor{NewFixedRateSampler(99.9), NewFixedRateSampler(99.9)}
+
+	keep, rate := processTelemetry(newSamplingTestRequest("0"), processors, func(appinsights.Telemetry) {})
+
+	assert.True(t, keep)
+	assert.InDelta(t, 99.8001, rate, 1e-9)
+}
+
+func Test_That_Sampler_Never_Samples_Metrics(t *testing.T) {
+	s := NewFixedRateSampler(0.1)
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, s.Process(appinsights.NewMetricTelemetry("metric", 1)))
+	}
+}
+
+func Test_That_AdaptiveSampler_Adjusts_Percentage_Towards_Target(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewAdaptiveSampler(1, WithSamplingInterval(10*time.Second), WithTypeSamplingTarget(DependencyType, 5)).(*sampler)
+	s.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 100; i++ {
+		s.percentage(RequestType)
+		s.percentage(DependencyType)
+	}
+	now = now.Add(10 * time.Second)
+	s.percentage(RequestType)
+
+	assert.InDelta(t, 10, s.percentages[RequestType], 0.2)
+	assert.InDelta(t, 50, s.percentages[DependencyType], 0.1)
+	assert.Equal(t, float64(100), s.percentage(EventType))
+}
+
+func Test_That_Track_Sends_Sampled_Telemetry_With_Sample_Rate(t *testing.T) {
+	channel := &sampling_mockChannel{}
+	m := &sampling_mockTelemetryClient{channel: channel}
+	m.ctx = appinsights.NewTelemetryContext("0000-1111")
+	m.ctx.CommonProperties["Team"] = "shop"
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initializer:     &mockInitializer{spec: newSpec()},
+		processors:      []TelemetryProcessor{NewFixedRateSampler(99.9)},
+	}
+
+	c.Track(newSamplingTestRequest("0"))
+
+	assert.Empty(t, m.items)
+	assert.Len(t, channel.envelopes, 1)
+	envelope := channel.envelopes[0]
+	assert.Equal(t, 99.9, envelope.SampleRate)
+	assert.Equal(t, "0000-1111", envelope.IKey)
+	assert.Equal(t, "Microsoft.ApplicationInsights.00001111.Request", envelope.Name)
+	assert.Equal(t, "0", envelope.Tags[contracts.OperationId])
+
+	data := envelope.Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	assert.Equal(t, "shop", data.Properties["Team"])
+	assert.Equal(t, "pod-name", data.Properties["Kubernetes.Pod.Name"])
+	for k := range data.Properties {
+		assert.NotContains(t, k, "SampleRate")
+	}
+}
+
+func Test_That_Envelop_Matches_Telemetry_Client_Envelope(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := gzip.NewReader(r.Body)
+		if err == nil {
+			var envelope map[string]interface{}
+			if json.NewDecoder(body).Decode(&envelope) == nil {
+				received <- envelope
+			}
+		}
+		_, _ = w.Write([]byte(`{"itemsReceived": 1, "itemsAccepted": 1, "errors": []}`))
+	}))
+	defer server.Close()
+
+	cfg := appinsights.NewTelemetryConfiguration("0000-1111")
+	cfg.EndpointUrl = server.URL
+	tc := appinsights.NewTelemetryClientFromConfig(cfg)
+	tc.Context().CommonProperties["Team"] = "shop"
+
+	newItem := func() appinsights.Telemetry {
+		item := newSamplingTestRequest("0")
+		item.Id = "request-id"
+		item.Timestamp = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		item.Properties["Kubernetes.Pod.Name"] = "pod-name"
+		return item
+	}
+
+	raw, err := json.Marshal(envelop(tc.Context(), newItem(), 50))
+	assert.NoError(t, err)
+	var expected map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &expected))
+
+	tc.Track(newItem())
+	<-tc.Channel().Close(time.Second)
+
+	actual := <-received
+	assert.Equal(t, 50.0, expected["sampleRate"])
+	delete(expected, "sampleRate")
+	delete(actual, "sampleRate")
+	assert.Equal(t, expected, actual)
+}
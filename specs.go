@@ -1,18 +1,42 @@
 package appink8s
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 )
 
+type podContainerTerminatedSpec struct {
+	ExitCode   int       `json:"exitCode"`
+	Signal     int       `json:"signal"`
+	Reason     string    `json:"reason"`
+	Message    string    `json:"message"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+type podContainerStateSpec struct {
+	Terminated *podContainerTerminatedSpec `json:"terminated"`
+}
+
 type podContainerStatusSpec struct {
-	Name  string `json:"name"`
-	Ready bool   `json:"ready"`
-	ID    string `json:"containerID"`
+	Name         string                `json:"name"`
+	Ready        bool                  `json:"ready"`
+	ID           string                `json:"containerID"`
+	RestartCount int                   `json:"restartCount"`
+	LastState    podContainerStateSpec `json:"lastState"`
+}
+
+func (cs podContainerStatusSpec) RuntimeContainerID() string {
+	p := strings.SplitN(cs.ID, "://", 2)
+	return p[len(p)-1]
 }
 
 type podStatusSpec struct {
+	Phase             string                   `json:"phase"`
+	PodIP             string                   `json:"podIP"`
 	ContainerStatuses []podContainerStatusSpec `json:"containerStatuses"`
 }
 
@@ -23,10 +47,12 @@ type podOwnerSpec struct {
 }
 
 type metaDataSpec struct {
-	Name   string            `json:"name"`
-	ID     string            `json:"uid"`
-	Labels map[string]string `json:"labels"`
-	Owners []podOwnerSpec    `json:"ownerReferences"`
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ID              string            `json:"uid"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+	Owners          []podOwnerSpec    `json:"ownerReferences"`
 }
 
 func (mds metaDataSpec) GetLabels() string {
@@ -42,7 +68,8 @@ func (mds metaDataSpec) GetLabels() string {
 }
 
 type podNodeSpec struct {
-	NodeName string `json:"nodeName"`
+	NodeName    string `json:"nodeName"`
+	HostNetwork bool   `json:"hostNetwork"`
 }
 
 type podSpec struct {
@@ -79,30 +106,94 @@ func (ps podSpec) FindDeploymentName() string {
 	return deploymentName
 }
 
+// FindWorkloadName returns the name of the workload that manages the pod,
+// i.e. its deployment or else its first owner, such as a StatefulSet.
+func (ps podSpec) FindWorkloadName() string {
+	if name := ps.FindDeploymentName(); name != "" {
+		return name
+	}
+
+	if len(ps.MetaData.Owners) > 0 {
+		return ps.MetaData.Owners[0].Name
+	}
+
+	return ""
+}
+
+type listMetaDataSpec struct {
+	ResourceVersion string `json:"resourceVersion"`
+	Continue        string `json:"continue"`
+}
+
 type podListSpec struct {
-	List []podSpec `json:"items"`
+	MetaData listMetaDataSpec `json:"metadata"`
+	List     []podSpec        `json:"items"`
 }
 
 type nodeSpec struct {
 	MetaData metaDataSpec `json:"metadata"`
 }
 
-type nodeListSpec struct {
-	List []nodeSpec `json:"items"`
+type serviceSelectorSpec struct {
+	Selector map[string]string `json:"selector"`
 }
 
-func (nls nodeListSpec) FindByName(name string) nodeSpec {
-	for _, n := range nls.List {
-		if n.MetaData.Name == name {
-			return n
-		}
+type serviceSpec struct {
+	MetaData metaDataSpec        `json:"metadata"`
+	Spec     serviceSelectorSpec `json:"spec"`
+}
+
+// LabelSelector returns the pod selector of the service as a label
+// selector query, or an empty string for services without a selector.
+func (ss serviceSpec) LabelSelector() string {
+	var selectors []string
+
+	for k, v := range ss.Spec.Selector {
+		selectors = append(selectors, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	return nodeSpec{
-		MetaData: metaDataSpec{
-			Name: name,
-		},
+	sort.Strings(selectors)
+	return strings.Join(selectors, ",")
+}
+
+type watchEventSpec struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type eventObjectSpec struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	ID        string `json:"uid"`
+	FieldPath string `json:"fieldPath"`
+}
+
+type eventSourceSpec struct {
+	Component string `json:"component"`
+	Host      string `json:"host"`
+}
+
+type eventSpec struct {
+	MetaData       metaDataSpec    `json:"metadata"`
+	InvolvedObject eventObjectSpec `json:"involvedObject"`
+	Type           string          `json:"type"`
+	Reason         string          `json:"reason"`
+	Message        string          `json:"message"`
+	Count          int             `json:"count"`
+	Source         eventSourceSpec `json:"source"`
+	FirstTimestamp time.Time       `json:"firstTimestamp"`
+	LastTimestamp  time.Time       `json:"lastTimestamp"`
+	EventTime      time.Time       `json:"eventTime"`
+}
+
+// Timestamp returns when the event last occurred. Events created through
+// the events.k8s.io API only set the event time.
+func (es eventSpec) Timestamp() time.Time {
+	if !es.LastTimestamp.IsZero() {
+		return es.LastTimestamp
 	}
+
+	return es.EventTime
 }
 
 type runtimeSpec struct {
@@ -116,6 +207,16 @@ type runtimeSpec struct {
 	NodeLabels     string
 	ContainerID    string
 	ContainerName  string
+	RestartCount   int
+	// LastTermination is how the previous instance of the container
+	// terminated, or nil if the container has not been restarted.
+	LastTermination *podContainerTerminatedSpec
+}
+
+func (r *runtimeSpec) setContainerStatus(cs podContainerStatusSpec) {
+	r.ContainerName = cs.Name
+	r.RestartCount = cs.RestartCount
+	r.LastTermination = cs.LastState.Terminated
 }
 
 func (r *runtimeSpec) ToPropertyMap() map[string]string {
@@ -128,9 +229,11 @@ func (r *runtimeSpec) ToPropertyMap() map[string]string {
 	props["Kubernetes.Deployment.Name"] = r.DeploymentName
 	props["Kubernetes.Container.ID"] = r.ContainerID
 	props["Kubernetes.Container.Name"] = r.ContainerName
-	props["Kubernetes.Node.ID"] = r.NodeID
 	props["Kubernetes.Node.Name"] = r.NodeName
-	props["Kubernetes.Node.Labels"] = r.NodeLabels
+	if r.NodeID != "" {
+		props["Kubernetes.Node.ID"] = r.NodeID
+		props["Kubernetes.Node.Labels"] = r.NodeLabels
+	}
 
 	return props
 }
@@ -104,31 +104,31 @@ func Test_That_PodSpec_FindDeploymentName_Returns_ReplicaSet_Prefix_When_Missing
 	assert.Equal(t, deploymentName, result)
 }
 
-func Test_That_NodeListSpec_FindByName_Returns_Matching_NodeSpec(t *testing.T) {
-	node := nodeSpec{
+func Test_That_RuntimeSpec_ToPropertyMap_Leaves_Out_Unknown_Node_Metadata(t *testing.T) {
+	spec := &runtimeSpec{
+		NodeName: "node-name",
+	}
+
+	props := spec.ToPropertyMap()
+
+	assert.Equal(t, "node-name", props["Kubernetes.Node.Name"])
+	assert.NotContains(t, props, "Kubernetes.Node.ID")
+	assert.NotContains(t, props, "Kubernetes.Node.Labels")
+}
+
+func Test_That_PodSpec_FindWorkloadName_Falls_Back_To_First_Owner(t *testing.T) {
+	deployment := podSpec{
 		MetaData: metaDataSpec{
-			ID:   "node-id",
-			Name: "node-name",
+			Owners: []podOwnerSpec{{Kind: "ReplicaSet", Name: "orders-7d9c6b5f4"}},
 		},
 	}
-	spec := nodeListSpec{
-		List: []nodeSpec{
-			nodeSpec{
-				MetaData: metaDataSpec{
-					ID:   "1",
-					Name: "1",
-				},
-			},
-			node,
-			nodeSpec{
-				MetaData: metaDataSpec{
-					ID:   "2",
-					Name: "2",
-				},
-			},
+	statefulSet := podSpec{
+		MetaData: metaDataSpec{
+			Owners: []podOwnerSpec{{Kind: "StatefulSet", Name: "postgres"}},
 		},
 	}
 
-	result := spec.FindByName(node.MetaData.Name)
-	assert.Equal(t, node, result)
+	assert.Equal(t, "orders", deployment.FindWorkloadName())
+	assert.Equal(t, "postgres", statefulSet.FindWorkloadName())
+	assert.Equal(t, "", podSpec{}.FindWorkloadName())
 }
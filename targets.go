@@ -0,0 +1,204 @@
+package appink8s
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const defaultClusterDomain = "cluster.local"
+
+// Resolved workloads are looked up again after workloadCacheTTL, as the
+// pods behind a Service change, and at most maxCachedWorkloads are kept.
+const workloadCacheTTL = 5 * time.Minute
+const maxCachedWorkloads = 1000
+
+type servicelookup interface {
+	CurrentNamespace() (string, error)
+	GetService(namespace, name string) (*serviceSpec, error)
+	GetNamespacePodMetadata(namespace, labelSelector string) (*podListSpec, error)
+}
+
+type targetWorkload struct {
+	workload string
+	expires  time.Time
+}
+
+// targetresolver adds the Kubernetes Service and namespace of dependency
+// targets that are cluster DNS names. When workloads are resolved, the
+// workload behind a Service is looked up in the background, and added to
+// the dependencies tracked after the lookup completes.
+type targetresolver struct {
+	lookup        servicelookup
+	clusterDomain string
+	workloads     bool
+	namespace     string
+	namespaceOnce sync.Once
+	lock          sync.Mutex
+	cache         map[string]targetWorkload
+	pending       map[string]bool
+	now           func() time.Time
+}
+
+func newTargetResolver(l servicelookup, clusterDomain string, workloads bool) *targetresolver {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+
+	return &targetresolver{
+		lookup:        l,
+		clusterDomain: strings.Trim(strings.ToLower(clusterDomain), "."),
+		workloads:     workloads,
+		cache:         make(map[string]targetWorkload),
+		pending:       make(map[string]bool),
+		now:           time.Now,
+	}
+}
+
+func (tr *targetresolver) apply(t *appinsights.RemoteDependencyTelemetry) {
+	tr.namespaceOnce.Do(func() {
+		tr.namespace, _ = tr.lookup.CurrentNamespace()
+	})
+
+	service, serviceNamespace, ok := parseServiceHost(targetHost(t.Target), tr.clusterDomain, tr.namespace)
+	if !ok {
+		return
+	}
+
+	t.Properties["Kubernetes.Target.InCluster"] = "true"
+	t.Properties["Kubernetes.Target.Service"] = service
+	t.Properties["Kubernetes.Target.Namespace"] = serviceNamespace
+
+	if tr.workloads {
+		if workload := tr.workload(serviceNamespace, service); workload != "" {
+			t.Properties["Kubernetes.Target.Workload"] = workload
+		}
+	}
+}
+
+// workload returns the cached workload of the service, and starts looking
+// it up when it is not known yet or has expired. An expired workload is
+// still returned until the lookup completes.
+func (tr *targetresolver) workload(namespace, service string) string {
+	key := fmt.Sprintf("%s/%s", namespace, service)
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	entry, ok := tr.cache[key]
+	if ok && tr.now().Before(entry.expires) {
+		return entry.workload
+	}
+
+	if !tr.pending[key] {
+		tr.pending[key] = true
+		go tr.resolve(key, namespace, service)
+	}
+
+	return entry.workload
+}
+
+func (tr *targetresolver) resolve(key, namespace, service string) {
+	workload := tr.readWorkload(namespace, service)
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if _, ok := tr.cache[key]; !ok && len(tr.cache) >= maxCachedWorkloads {
+		tr.evict()
+	}
+
+	tr.cache[key] = targetWorkload{
+		workload: workload,
+		expires:  tr.now().Add(workloadCacheTTL),
+	}
+	delete(tr.pending, key)
+}
+
+// evict removes the expired workloads from the cache, or an arbitrary one
+// when none has expired.
+func (tr *targetresolver) evict() {
+	now := tr.now()
+	for key, entry := range tr.cache {
+		if !now.Before(entry.expires) {
+			delete(tr.cache, key)
+		}
+	}
+
+	if len(tr.cache) < maxCachedWorkloads {
+		return
+	}
+	for key := range tr.cache {
+		delete(tr.cache, key)
+		return
+	}
+}
+
+// readWorkload returns the workload of the first pod selected by the
+// service. Failures, e.g. missing permissions, are cached as no workload
+// so that they are not retried for every dependency.
+func (tr *targetresolver) readWorkload(namespace, service string) string {
+	svc, err := tr.lookup.GetService(namespace, service)
+	if err != nil {
+		return ""
+	}
+
+	selector := svc.LabelSelector()
+	if selector == "" {
+		return ""
+	}
+
+	pods, err := tr.lookup.GetNamespacePodMetadata(namespace, selector)
+	if err != nil || len(pods.List) == 0 {
+		return ""
+	}
+
+	return pods.List[0].FindWorkloadName()
+}
+
+// targetHost returns the host name of a dependency target, which is a
+// host, a host and port, or a URL.
+func targetHost(target string) string {
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil {
+			return u.Hostname()
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+
+	return target
+}
+
+// parseServiceHost returns the Service and namespace named by a cluster
+// DNS name: <service>.<namespace>.svc.<cluster domain>, the shorter
+// <service>.<namespace>.svc, or a bare <service> in the current namespace.
+func parseServiceHost(host, clusterDomain, namespace string) (string, string, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == "localhost" || net.ParseIP(host) != nil {
+		return "", "", false
+	}
+
+	if !strings.Contains(host, ".") {
+		return host, namespace, namespace != ""
+	}
+
+	host = strings.TrimSuffix(host, "."+clusterDomain)
+	if !strings.HasSuffix(host, ".svc") {
+		return "", "", false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, ".svc"), ".")
+	if len(labels) != 2 {
+		return "", "", false
+	}
+
+	return labels[0], labels[1], true
+}
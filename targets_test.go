@@ -0,0 +1,184 @@
+package appink8s
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+type targets_mockLookup struct {
+	namespace string
+	services  map[string]*serviceSpec
+	pods      *podListSpec
+	selectors []string
+}
+
+func (m *targets_mockLookup) CurrentNamespace() (string, error) {
+	return m.namespace, nil
+}
+
+func (m *targets_mockLookup) GetService(namespace, name string) (*serviceSpec, error) {
+	if svc, ok := m.services[namespace+"/"+name]; ok {
+		return svc, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *targets_mockLookup) GetNamespacePodMetadata(namespace, labelSelector string) (*podListSpec, error) {
+	m.selectors = append(m.selectors, labelSelector)
+	if m.pods == nil {
+		return nil, errors.New("forbidden")
+	}
+
+	return m.pods, nil
+}
+
+func Test_That_ParseServiceHost_Parses_Cluster_DNS_Names(t *testing.T) {
+	cases := []struct {
+		host      string
+		service   string
+		namespace string
+		ok        bool
+	}{
+		{"orders", "orders", "default", true},
+		{"orders.shop.svc", "orders", "shop", true},
+		{"orders.shop.svc.cluster.local", "orders", "shop", true},
+		{"Orders.Shop.svc.cluster.local.", "orders", "shop", true},
+		{"orders.shop.svc.example.internal", "", "", false},
+		{"pod-1.orders.shop.svc.cluster.local", "", "", false},
+		{"example.com", "", "", false},
+		{"localhost", "", "", false},
+		{"10.0.0.1", "", "", false},
+	}
+
+	for _, c := range cases {
+		service, namespace, ok := parseServiceHost(c.host, "cluster.local", "default")
+
+		assert.Equal(t, c.ok, ok, c.host)
+		assert.Equal(t, c.service, service, c.host)
+		assert.Equal(t, c.namespace, namespace, c.host)
+	}
+}
+
+func Test_That_TargetHost_Strips_Port_And_Scheme(t *testing.T) {
+	assert.Equal(t, "orders", targetHost("orders"))
+	assert.Equal(t, "orders.shop.svc", targetHost("orders.shop.svc:8080"))
+	assert.Equal(t, "orders", targetHost("http://orders:8080/api"))
+}
+
+func Test_That_Apply_Adds_Target_Service_And_Namespace(t *testing.T) {
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "example.internal", false)
+	dep := appinsights.NewRemoteDependencyTelemetry("GET /", "HTTP", "orders.shop.svc.example.internal:8080", true)
+
+	tr.apply(dep)
+
+	assert.Equal(t, "true", dep.Properties["Kubernetes.Target.InCluster"])
+	assert.Equal(t, "orders", dep.Properties["Kubernetes.Target.Service"])
+	assert.Equal(t, "shop", dep.Properties["Kubernetes.Target.Namespace"])
+	assert.NotContains(t, dep.Properties, "Kubernetes.Target.Workload")
+}
+
+func Test_That_Apply_Skips_Default_Cluster_Domain_When_Custom_Domain_Is_Set(t *testing.T) {
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "example.internal", false)
+	dep := appinsights.NewRemoteDependencyTelemetry("GET /", "HTTP", "orders.shop.svc.cluster.local:8080", true)
+
+	tr.apply(dep)
+
+	assert.Empty(t, dep.Properties)
+}
+
+func Test_That_Apply_Skips_External_Targets(t *testing.T) {
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "", false)
+	dep := appinsights.NewRemoteDependencyTelemetry("GET /", "HTTP", "api.example.com", true)
+
+	tr.apply(dep)
+
+	assert.Empty(t, dep.Properties)
+}
+
+func Test_That_Apply_Adds_Resolved_Target_Workload(t *testing.T) {
+	lookup := &targets_mockLookup{
+		namespace: "default",
+		services: map[string]*serviceSpec{
+			"shop/orders": {Spec: serviceSelectorSpec{Selector: map[string]string{"app": "orders"}}},
+		},
+		pods: &podListSpec{
+			List: []podSpec{{MetaData: metaDataSpec{Owners: []podOwnerSpec{{Kind: "ReplicaSet", Name: "orders-api-7d9c6b5f4"}}}}},
+		},
+	}
+	tr := newTargetResolver(lookup, "", true)
+	tr.resolve("shop/orders", "shop", "orders")
+
+	dep := appinsights.NewRemoteDependencyTelemetry("GET /", "HTTP", "orders.shop.svc", true)
+	tr.apply(dep)
+
+	assert.Equal(t, "orders-api", dep.Properties["Kubernetes.Target.Workload"])
+	assert.Equal(t, []string{"app=orders"}, lookup.selectors)
+}
+
+func Test_That_ReadWorkload_Returns_Empty_Workload_On_Errors(t *testing.T) {
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "", true)
+
+	assert.Equal(t, "", tr.readWorkload("shop", "orders"))
+}
+
+func Test_That_Track_Adds_Target_Properties_To_Dependencies(t *testing.T) {
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initializer:     &mockInitializer{spec: newSpec()},
+		targets:         newTargetResolver(&targets_mockLookup{namespace: "default"}, "", false),
+	}
+
+	c.TrackRemoteDependency("GET /", "HTTP", "orders:8080", true)
+
+	dep := m.tracked.(*appinsights.RemoteDependencyTelemetry)
+	assert.Equal(t, "orders", dep.Properties["Kubernetes.Target.Service"])
+	assert.Equal(t, "default", dep.Properties["Kubernetes.Target.Namespace"])
+}
+
+func Test_That_Workload_Is_Looked_Up_Again_After_Expiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "", true)
+	tr.now = func() time.Time { return now }
+	tr.cache["shop/orders"] = targetWorkload{workload: "orders-api", expires: now.Add(time.Minute)}
+
+	assert.Equal(t, "orders-api", tr.workload("shop", "orders"))
+	assert.Empty(t, tr.pending)
+
+	now = now.Add(2 * time.Minute)
+	tr.lock.Lock()
+	tr.pending["shop/orders"] = true
+	tr.lock.Unlock()
+
+	assert.Equal(t, "orders-api", tr.workload("shop", "orders"))
+}
+
+func Test_That_Resolve_Bounds_Workload_Cache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newTargetResolver(&targets_mockLookup{namespace: "default"}, "", true)
+	tr.now = func() time.Time { return now }
+	for i := 0; i < maxCachedWorkloads; i++ {
+		tr.cache[fmt.Sprintf("shop/service-%d", i)] = targetWorkload{expires: now.Add(time.Minute)}
+	}
+	tr.cache["shop/service-0"] = targetWorkload{expires: now}
+
+	tr.resolve("shop/orders", "shop", "orders")
+
+	assert.Len(t, tr.cache, maxCachedWorkloads)
+	assert.Contains(t, tr.cache, "shop/orders")
+	assert.NotContains(t, tr.cache, "shop/service-0")
+
+	tr.resolve("shop/payments", "shop", "payments")
+
+	assert.Len(t, tr.cache, maxCachedWorkloads)
+	assert.Contains(t, tr.cache, "shop/payments")
+}
@@ -1,7 +1,10 @@
 package appink8s
 
 import (
+	"context"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Microsoft/ApplicationInsights-Go/appinsights/contracts"
@@ -9,6 +12,8 @@ import (
 	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
 )
 
+const internalTelemetryProperty = "Kubernetes.Telemetry.Internal"
+
 type initializer interface {
 	ReadPropertySpec() (*runtimeSpec, error)
 }
@@ -18,67 +23,396 @@ type kubernetesTelemetryClient struct {
 	active      bool
 	initializer initializer
 	initialized bool
+	loading     bool
+	deferred    bool
+	ctx         context.Context
+	events      *eventforwarder
+	targets     *targetresolver
+	sources     *podindex
+	processors  []TelemetryProcessor
+	metrics     *metricaggregator
+	spec        *runtimeSpec
+	err         error
 	lock        sync.RWMutex
 	properties  map[string]string
+	role        atomic.Value
+}
+
+// cloudRole is the cloud role and role instance of the telemetry of a
+// client, stored once the Kubernetes properties are read.
+type cloudRole struct {
+	name     string
+	instance string
 }
 
 func NewTelemetryClient(iKey string) appinsights.TelemetryClient {
-	cfg := newK8sConfig()
-	if !cfg.RunningInKubernetes() {
-		return appinsights.NewTelemetryClient(iKey)
-	}
+	return NewTelemetryClientWithOptions(iKey)
+}
+
+// NewTelemetryClientWithOptions creates a telemetry client like
+// NewTelemetryClient, with its Kubernetes and Application Insights
+// settings overridden by opts.
+func NewTelemetryClientWithOptions(iKey string, opts ...Option) appinsights.TelemetryClient {
+	o := newOptions(opts...)
+	tc := appinsights.NewTelemetryClientFromConfig(o.TelemetryConfiguration(iKey))
+	return newTelemetryClient(tc, o)
+}
+
+// NewTelemetryClientFromConfig creates a telemetry client that submits
+// telemetry as configured by config, e.g. to a custom ingestion endpoint.
+func NewTelemetryClientFromConfig(config *appinsights.TelemetryConfiguration, opts ...Option) appinsights.TelemetryClient {
+	opts = append([]Option{WithTelemetryConfiguration(config)}, opts...)
+	return NewTelemetryClientWithOptions("", opts...)
+}
 
-	client, err := newK8sClient(cfg)
+func newTelemetryClient(tc appinsights.TelemetryClient, o *options) appinsights.TelemetryClient {
+	client, err := newClientFromOptions(o)
 	if err != nil {
-		return appinsights.NewTelemetryClient(iKey)
+		// The client keeps the error for EnrichmentError, and the
+		// processors, aggregation and heartbeat still run, without the
+		// Kubernetes properties.
+		ktc := &kubernetesTelemetryClient{
+			TelemetryClient: tc,
+			initialized:     true,
+			err:             err,
+			processors:      o.processors,
+		}
+		ktc.startMetricAggregation(o)
+		ktc.startHeartbeat(o)
+
+		return ktc
 	}
 
-	return &kubernetesTelemetryClient{
-		TelemetryClient: appinsights.NewTelemetryClient(iKey),
+	ktc := &kubernetesTelemetryClient{
+		TelemetryClient: tc,
 		active:          true,
-		initializer:     newK8sInitializer(client),
+		initializer:     newK8sInitializer(client, o.podName),
 		initialized:     false,
+		ctx:             o.ctx,
+		targets:         newTargetResolver(client, o.clusterDomain, o.targetWorkloads),
+		processors:      o.processors,
 		properties:      make(map[string]string),
 	}
+
+	if o.forwardEvents {
+		ktc.events = newEventForwarder(client, ktc.Track)
+	}
+
+	if o.trackAPICalls {
+		client.tracker = ktc.trackInternal
+	}
+
+	if o.sourcePods {
+		ktc.sources = newPodIndex(client, o.sourceCluster)
+		go ktc.sources.Run(o.ctx)
+	}
+
+	ktc.startMetricAggregation(o)
+	ktc.startHeartbeat(o)
+
+	if o.metricsInterval > 0 {
+		go newResourceCollector(newCGroupFS(o.root), ktc.Track).Run(o.ctx, o.metricsInterval)
+	}
+
+	// The properties are read in the background right away, so that the
+	// termination event and the event watch do not wait for the first
+	// telemetry.
+	if o.startupJitter > 0 {
+		ktc.deferred = true
+		go ktc.initializeAfter(o.ctx, randomDuration(o.startupJitter))
+	} else {
+		go ktc.initialize()
+	}
+
+	return ktc
 }
 
-func (ktc *kubernetesTelemetryClient) apply(properties map[string]string) {
-	if !ktc.initialized {
-		ktc.initialize()
+func (ktc *kubernetesTelemetryClient) startMetricAggregation(o *options) {
+	if o.aggregateEvery <= 0 {
+		return
 	}
 
-	if !ktc.active {
+	ktc.metrics = newMetricAggregator(ktc.Track)
+	go ktc.metrics.Run(o.ctx, o.aggregateEvery)
+}
+
+func (ktc *kubernetesTelemetryClient) startHeartbeat(o *options) {
+	if o.heartbeatEvery <= 0 {
 		return
 	}
 
+	go newHeartbeat(ktc.process, ktc.resolvedSpec).Run(o.ctx, o.heartbeatEvery)
+}
+
+func randomDuration(max time.Duration) time.Duration {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return time.Duration(r.Int63n(int64(max)))
+}
+
+func newClientFromOptions(o *options) (*k8sclient, error) {
+	if o.useKubeconfig {
+		return newKubeconfigClient(o)
+	}
+
+	cfg := newK8sConfig(o)
+	if !cfg.RunningInKubernetes() {
+		return nil, ErrNotInCluster
+	}
+
+	return newK8sClient(cfg, o)
+}
+
+func (ktc *kubernetesTelemetryClient) isInitialized() bool {
+	ktc.lock.RLock()
+	defer ktc.lock.RUnlock()
+
+	return ktc.initialized
+}
+
+// isPending reports whether reading the Kubernetes properties is deferred
+// or in flight, and has not completed yet.
+func (ktc *kubernetesTelemetryClient) isPending() bool {
 	ktc.lock.RLock()
 	defer ktc.lock.RUnlock()
 
+	return !ktc.initialized && (ktc.deferred || ktc.loading)
+}
+
+func (ktc *kubernetesTelemetryClient) apply(properties map[string]string) {
+	if ktc.isPending() {
+		return
+	}
+	if !ktc.isInitialized() {
+		ktc.initialize()
+	}
+
+	ktc.lock.RLock()
+	defer ktc.lock.RUnlock()
+
+	if !ktc.active {
+		return
+	}
+
 	for k, v := range ktc.properties {
 		properties[k] = v
 	}
 }
 
+// applyTags sets the cloud role and role instance to the deployment and
+// pod, unless they are set already. They are set on every item rather than
+// on the shared context, which the telemetry client reads concurrently.
+// The role is stored atomically rather than guarded by the lock, so that
+// internal telemetry tracked while the properties are read never waits on
+// it.
+func (ktc *kubernetesTelemetryClient) applyTags(tags contracts.ContextTags) {
+	role, ok := ktc.role.Load().(cloudRole)
+	if !ok {
+		return
+	}
+
+	if _, ok := tags[contracts.CloudRole]; !ok {
+		tags.Cloud().SetRole(role.name)
+	}
+	if _, ok := tags[contracts.CloudRoleInstance]; !ok {
+		tags.Cloud().SetRoleInstance(role.instance)
+	}
+}
+
+// initializeAfter reads the Kubernetes properties after delay. When ctx is
+// done first, they are no longer deferred but read on first use instead.
+func (ktc *kubernetesTelemetryClient) initializeAfter(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		ktc.lock.Lock()
+		ktc.deferred = false
+		ktc.lock.Unlock()
+	case <-timer.C:
+		ktc.initialize()
+	}
+}
+
+// initialize reads the Kubernetes properties once. When the container was
+// restarted, how its previous instance terminated is tracked as an event,
+// after the lock is released since tracking applies the properties.
 func (ktc *kubernetesTelemetryClient) initialize() {
+	spec := ktc.load()
+	if spec != nil && spec.LastTermination != nil {
+		ktc.Track(newTerminationEventTelemetry(spec))
+	}
+}
+
+// load reads the Kubernetes properties and returns the spec they were read
+// from, or nil if they were already read or are being read by another
+// call, or could not be read. The lock is not held while the Kubernetes API
+// is requested, so that telemetry tracked meanwhile is sent without the
+// Kubernetes properties rather than blocked.
+func (ktc *kubernetesTelemetryClient) load() *runtimeSpec {
 	ktc.lock.Lock()
-	defer ktc.lock.Unlock()
+	if ktc.initialized || ktc.loading {
+		ktc.lock.Unlock()
+		return nil
+	}
+	ktc.loading = true
+	ktc.lock.Unlock()
 
 	spec, err := ktc.initializer.ReadPropertySpec()
-	ktc.active = err == nil
+
+	ktc.lock.Lock()
+	ktc.loading = false
 	ktc.initialized = true
-	ktc.properties = spec.ToPropertyMap()
+	ktc.active = err == nil
+	ktc.err = err
+	if err == nil {
+		ktc.spec = spec
+		ktc.properties = spec.ToPropertyMap()
+	}
+	ktc.lock.Unlock()
 
 	if err == nil && spec.DeploymentName != "" {
-		ktc.Context().Tags.Cloud().SetRole(spec.DeploymentName)
-		ktc.Context().Tags.Cloud().SetRoleInstance(spec.PodName)
+		ktc.role.Store(cloudRole{name: spec.DeploymentName, instance: spec.PodName})
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	if ktc.events != nil && spec.PodID != "" {
+		go ktc.events.Run(ktc.ctx, spec.PodID)
+	}
+
+	return spec
+}
+
+// Err returns the error that deactivated the Kubernetes properties, if any,
+// or ErrPending while reading them is deferred or in flight.
+func (ktc *kubernetesTelemetryClient) Err() error {
+	if ktc.isPending() {
+		return ErrPending
+	}
+	if !ktc.isInitialized() {
+		ktc.initialize()
+	}
+
+	ktc.lock.RLock()
+	defer ktc.lock.RUnlock()
+
+	return ktc.err
+}
+
+// resolvedSpec returns the spec the Kubernetes properties were read from,
+// or the error that deactivated them. Both are nil while reading the
+// properties is deferred or in flight.
+func (ktc *kubernetesTelemetryClient) resolvedSpec() (*runtimeSpec, error) {
+	if ktc.isPending() {
+		return nil, nil
+	}
+	if !ktc.isInitialized() {
+		ktc.initialize()
 	}
+
+	ktc.lock.RLock()
+	defer ktc.lock.RUnlock()
+
+	return ktc.spec, ktc.err
 }
 
+// Channel returns the channel of the client. With metric aggregation, the
+// aggregated metrics are tracked when it is flushed or closed.
+func (ktc *kubernetesTelemetryClient) Channel() appinsights.TelemetryChannel {
+	if ktc.metrics == nil {
+		return ktc.TelemetryClient.Channel()
+	}
+
+	return &flushingChannel{
+		TelemetryChannel: ktc.TelemetryClient.Channel(),
+		metrics:          ktc.metrics,
+	}
+}
+
+// Track runs t through the chain of telemetry processors, which includes
+// the Kubernetes enrichment and any sampling, and sends it unless a
+// processor dropped it. Metrics are aggregated first when aggregation is
+// enabled, and their aggregates are tracked when the interval is over.
 func (ktc *kubernetesTelemetryClient) Track(t appinsights.Telemetry) {
-	ktc.apply(t.GetProperties())
+	if metric, ok := t.(*appinsights.MetricTelemetry); ok && ktc.metrics != nil && ktc.metrics.Add(metric) {
+		return
+	}
+
+	ktc.process(t)
+}
+
+// process runs t through the chain of telemetry processors and sends it,
+// without aggregating metrics.
+func (ktc *kubernetesTelemetryClient) process(t appinsights.Telemetry) {
+	keep, rate := processTelemetry(t, ktc.processors, ktc.enrich)
+	if !keep {
+		return
+	}
+
+	if rate < 100 {
+		ktc.send(t, rate)
+		return
+	}
+
 	ktc.TelemetryClient.Track(t)
 }
 
+// send sends sampled telemetry with its sample rate, so that counts are
+// extrapolated from the items that were kept. The context and channel are
+// taken from the same client, which a key rotation cannot swap out or
+// close while the item is sent.
+func (ktc *kubernetesTelemetryClient) send(t appinsights.Telemetry, sampleRate float64) {
+	send := func(tc appinsights.TelemetryClient) {
+		if tc.IsEnabled() {
+			tc.Channel().Send(envelop(tc.Context(), t, sampleRate))
+		}
+	}
+
+	if rtc, ok := ktc.TelemetryClient.(*rotatingTelemetryClient); ok {
+		rtc.do(send)
+		return
+	}
+
+	send(ktc.TelemetryClient)
+}
+
+// enrich adds the Kubernetes properties to t, unless t is internal.
+func (ktc *kubernetesTelemetryClient) enrich(t appinsights.Telemetry) {
+	if isInternalTelemetry(t) {
+		return
+	}
+
+	ktc.apply(t.GetProperties())
+	ktc.applyTags(t.ContextTags())
+
+	if dependency, ok := t.(*appinsights.RemoteDependencyTelemetry); ok && ktc.targets != nil {
+		ktc.targets.apply(dependency)
+	}
+	if request, ok := t.(*appinsights.RequestTelemetry); ok && ktc.sources != nil {
+		ktc.sources.apply(request)
+	}
+}
+
+// trackInternal tracks telemetry about the client itself. The telemetry is
+// marked as internal so that it never triggers enrichment, which could in
+// turn request the Kubernetes API and track more telemetry, but it still
+// runs through the other processors, which may drop or sample it. It gets
+// the cloud role once known, so that it shows up as part of the
+// application.
+func (ktc *kubernetesTelemetryClient) trackInternal(t appinsights.Telemetry) {
+	t.GetProperties()[internalTelemetryProperty] = "true"
+	ktc.applyTags(t.ContextTags())
+	ktc.process(t)
+}
+
+func isInternalTelemetry(t appinsights.Telemetry) bool {
+	_, ok := t.GetProperties()[internalTelemetryProperty]
+	return ok
+}
+
 func (ktc *kubernetesTelemetryClient) TrackAvailability(name string, duration time.Duration, success bool) {
 	t := appinsights.NewAvailabilityTelemetry(name, duration, success)
 	ktc.Track(t)
@@ -1,7 +1,10 @@
 package appink8s
 
 import (
+	"context"
 	"errors"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -43,6 +46,25 @@ func (*mockTelemetryClient) TrackRequest(method, uri string, duration time.Durat
 }
 func (*mockTelemetryClient) TrackTrace(name string, severity contracts.SeverityLevel) {}
 
+// telemetry_mockEnvelopingClient reads the shared context tags on every
+// item, like the telemetry client does when it wraps the item.
+type telemetry_mockEnvelopingClient struct {
+	mockTelemetryClient
+	lock  sync.Mutex
+	count int
+}
+
+func (m *telemetry_mockEnvelopingClient) Track(t appinsights.Telemetry) {
+	tags := make(map[string]string)
+	for k, v := range m.ctx.Tags {
+		tags[k] = v
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.count++
+}
+
 type mockInitializer struct {
 	called int
 	spec   *runtimeSpec
@@ -59,6 +81,19 @@ func (m *mockInitializer) ReadPropertySpec() (*runtimeSpec, error) {
 	return &runtimeSpec{}, m.err
 }
 
+// telemetry_slowInitializer reads the spec once release is closed, like an
+// initializer that waits for the Kubernetes API.
+type telemetry_slowInitializer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *telemetry_slowInitializer) ReadPropertySpec() (*runtimeSpec, error) {
+	close(m.started)
+	<-m.release
+	return newSpec(), nil
+}
+
 func Test_That_Apply_Initializes_Property_Handling_When_Uninitialized(t *testing.T) {
 	c := &kubernetesTelemetryClient{
 		active:      true,
@@ -132,7 +167,7 @@ func Test_That_Apply_Skips_Telemetry_Enhancing_Properties_When_Deactivated(t *te
 	assert.NotEqual(t, p, m)
 }
 
-func Test_That_Initialize_Assigns_Telemetry_Context_Role_To_DeploymentName(t *testing.T) {
+func Test_That_Track_Assigns_Role_To_DeploymentName(t *testing.T) {
 	s := newSpec()
 
 	c := &kubernetesTelemetryClient{
@@ -142,16 +177,16 @@ func Test_That_Initialize_Assigns_Telemetry_Context_Role_To_DeploymentName(t *te
 		active:      true,
 		initialized: false,
 		initializer: &mockInitializer{spec: s},
-		properties:  s.ToPropertyMap(),
 	}
 
-	c.initialize()
+	m := appinsights.NewEventTelemetry("test")
+	c.Track(m)
 
-	role := c.TelemetryClient.Context().Tags.Cloud().GetRole()
-	assert.Equal(t, s.DeploymentName, role)
+	assert.Equal(t, s.DeploymentName, m.Tags.Cloud().GetRole())
+	assert.Empty(t, c.TelemetryClient.Context().Tags.Cloud().GetRole())
 }
 
-func Test_That_Initialize_Assigns_Telemetry_Context_RoleInstance_To_PodName(t *testing.T) {
+func Test_That_Track_Assigns_RoleInstance_To_PodName(t *testing.T) {
 	s := newSpec()
 
 	c := &kubernetesTelemetryClient{
@@ -161,13 +196,180 @@ func Test_That_Initialize_Assigns_Telemetry_Context_RoleInstance_To_PodName(t *t
 		active:      true,
 		initialized: false,
 		initializer: &mockInitializer{spec: s},
-		properties:  s.ToPropertyMap(),
+	}
+
+	m := appinsights.NewEventTelemetry("test")
+	c.Track(m)
+
+	assert.Equal(t, s.PodName, m.Tags.Cloud().GetRoleInstance())
+	assert.Empty(t, c.TelemetryClient.Context().Tags.Cloud().GetRoleInstance())
+}
+
+func Test_That_Track_Keeps_Role_Set_On_Telemetry(t *testing.T) {
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: &mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+		active:      true,
+		initialized: false,
+		initializer: &mockInitializer{spec: newSpec()},
+	}
+
+	m := appinsights.NewEventTelemetry("test")
+	m.Tags.Cloud().SetRole("role")
+	c.Track(m)
+
+	assert.Equal(t, "role", m.Tags.Cloud().GetRole())
+}
+
+func Test_That_Deferred_Initialization_Does_Not_Race_Track(t *testing.T) {
+	m := &telemetry_mockEnvelopingClient{
+		mockTelemetryClient: mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		deferred:        true,
+		initializer:     &mockInitializer{spec: newSpec()},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.Track(appinsights.NewEventTelemetry("test"))
+		}
+	}()
+	c.initializeAfter(context.Background(), 0)
+	<-done
+
+	assert.Equal(t, 100, m.count)
+}
+
+func Test_That_Track_Does_Not_Wait_For_Initialization_In_Flight(t *testing.T) {
+	i := &telemetry_slowInitializer{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		deferred:        true,
+		initializer:     i,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.initializeAfter(context.Background(), 0)
+	}()
+	<-i.started
+
+	e := appinsights.NewEventTelemetry("test")
+	c.Track(e)
+
+	assert.Equal(t, ErrPending, c.Err())
+	assert.Empty(t, e.Properties)
+	assert.Empty(t, e.Tags.Cloud().GetRole())
+
+	close(i.release)
+	<-done
+
+	e = appinsights.NewEventTelemetry("test")
+	c.Track(e)
+
+	assert.NoError(t, c.Err())
+	assert.Equal(t, newSpec().PodName, e.Properties["Kubernetes.Pod.Name"])
+}
+
+// telemetry_mockChannelClient passes tracked telemetry on to a channel, for
+// telemetry tracked in the background.
+type telemetry_mockChannelClient struct {
+	mockTelemetryClient
+	tracked chan appinsights.Telemetry
+}
+
+func (m *telemetry_mockChannelClient) Track(t appinsights.Telemetry) {
+	m.tracked <- t
+}
+
+func Test_That_NewTelemetryClient_Tracks_Last_Container_Termination_On_Startup(t *testing.T) {
+	root := newOptionsTestRoot(t)
+	defer os.RemoveAll(root)
+	writeOptionsTestCluster(t, root)
+	srv := newOptionsTestServer(k8sRestartedPodResponse)
+	defer srv.Close()
+	m := &telemetry_mockChannelClient{
+		mockTelemetryClient: mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+		tracked: make(chan appinsights.Telemetry, 1),
+	}
+
+	newTelemetryClient(m, newOptions(
+		WithFileSystemRoot(root),
+		WithKubernetesHost(srv.URL),
+		WithHTTPClient(srv.Client()),
+	))
+
+	select {
+	case tracked := <-m.tracked:
+		event := tracked.(*appinsights.EventTelemetry)
+		assert.Equal(t, "Kubernetes.Container.Terminated", event.Name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no termination event was tracked")
+	}
+}
+
+func Test_That_Initialize_Tracks_Last_Container_Termination(t *testing.T) {
+	s := newSpec()
+	s.RestartCount = 1
+	s.LastTermination = &podContainerTerminatedSpec{
+		Reason:   "OOMKilled",
+		ExitCode: 137,
+	}
+
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		initializer:     &mockInitializer{spec: s},
 	}
 
 	c.initialize()
 
-	instance := c.TelemetryClient.Context().Tags.Cloud().GetRoleInstance()
-	assert.Equal(t, s.PodName, instance)
+	event, ok := m.tracked.(*appinsights.EventTelemetry)
+	assert.True(t, ok)
+	assert.Equal(t, "Kubernetes.Container.Terminated", event.Name)
+	assert.Equal(t, "OOMKilled", event.Properties["Kubernetes.Container.LastTermination.Reason"])
+	assert.Equal(t, s.PodName, event.Properties["Kubernetes.Pod.Name"])
+}
+
+func Test_That_Initialize_Skips_Termination_Event_Without_Restart(t *testing.T) {
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		initializer:     &mockInitializer{spec: newSpec()},
+	}
+
+	c.initialize()
+	c.initialize()
+
+	assert.Nil(t, m.tracked)
 }
 
 func Test_That_Track_Adds_Kubernetes_Properties_To_Telemetry(t *testing.T) {
@@ -190,6 +392,110 @@ func Test_That_Track_Adds_Kubernetes_Properties_To_Telemetry(t *testing.T) {
 	assert.Equal(t, p, m.GetProperties())
 }
 
+func Test_That_Apply_Skips_Initialization_When_Deferred(t *testing.T) {
+	i := &mockInitializer{}
+	c := &kubernetesTelemetryClient{
+		active:      true,
+		initialized: false,
+		deferred:    true,
+		initializer: i,
+	}
+
+	m := make(map[string]string)
+	c.apply(m)
+
+	assert.Equal(t, 0, i.called)
+	assert.Empty(t, m)
+}
+
+func Test_That_InitializeAfter_Initializes_After_Delay(t *testing.T) {
+	i := &mockInitializer{}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: &mockTelemetryClient{
+			ctx: appinsights.NewTelemetryContext(""),
+		},
+		active:      true,
+		initialized: false,
+		deferred:    true,
+		initializer: i,
+	}
+
+	c.initializeAfter(context.Background(), time.Millisecond)
+
+	assert.True(t, c.initialized)
+	assert.Equal(t, 1, i.called)
+}
+
+func Test_That_InitializeAfter_Stops_When_Context_Is_Done(t *testing.T) {
+	i := &mockInitializer{}
+	c := &kubernetesTelemetryClient{
+		initialized: false,
+		deferred:    true,
+		initializer: i,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.initializeAfter(ctx, time.Hour)
+
+	assert.False(t, c.initialized)
+	assert.False(t, c.isPending())
+}
+
+func Test_That_Err_Returns_ErrPending_When_Deferred(t *testing.T) {
+	i := &mockInitializer{}
+	c := &kubernetesTelemetryClient{
+		initialized: false,
+		deferred:    true,
+		initializer: i,
+	}
+
+	assert.Equal(t, ErrPending, c.Err())
+	assert.Equal(t, 0, i.called)
+}
+
+func Test_That_TrackInternal_Marks_Telemetry_And_Skips_Enrichment(t *testing.T) {
+	i := &mockInitializer{spec: newSpec()}
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		initializer:     i,
+	}
+
+	d := appinsights.NewRemoteDependencyTelemetry("GET /api/v1/nodes/node", "Kubernetes API", "host", true)
+	c.trackInternal(d)
+	c.Track(d)
+
+	assert.Equal(t, 0, i.called)
+	assert.Equal(t, d, m.tracked)
+	assert.Equal(t, "true", d.Properties[internalTelemetryProperty])
+	assert.NotContains(t, d.Properties, "Kubernetes.Pod.Name")
+}
+
+func Test_That_TrackInternal_Assigns_Role_Once_Initialized(t *testing.T) {
+	s := newSpec()
+	m := &mockTelemetryClient{
+		ctx: appinsights.NewTelemetryContext(""),
+	}
+	c := &kubernetesTelemetryClient{
+		TelemetryClient: m,
+		active:          true,
+		initialized:     false,
+		initializer:     &mockInitializer{spec: s},
+	}
+	c.initialize()
+
+	d := appinsights.NewRemoteDependencyTelemetry("GET /api/v1/nodes/node", "Kubernetes API", "host", true)
+	c.trackInternal(d)
+
+	assert.Equal(t, s.DeploymentName, d.Tags.Cloud().GetRole())
+	assert.Equal(t, s.PodName, d.Tags.Cloud().GetRoleInstance())
+}
+
 func newSpec() *runtimeSpec {
 	return &runtimeSpec{
 		ContainerID:    "container-id",
@@ -0,0 +1,79 @@
+package appink8s
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+)
+
+const httpDependencyType = "HTTP"
+
+type transport struct {
+	client appinsights.TelemetryClient
+	base   http.RoundTripper
+}
+
+// NewTransport returns an http.RoundTripper that tracks every request made
+// through base as dependency telemetry with client. The traceparent and
+// Request-Id headers are set from the operation on the request context, so
+// that the called service continues the operation. A nil base uses
+// http.DefaultTransport.
+func NewTransport(client appinsights.TelemetryClient, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{
+		client: client,
+		base:   base,
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var op Operation
+	if parent, ok := OperationFromContext(req.Context()); ok {
+		op = parent.Child()
+	} else {
+		op = Operation{
+			ID:     newTraceID(),
+			SpanID: newSpanID(),
+		}
+	}
+
+	out := req.Clone(req.Context())
+	out.Header.Set(traceparentHeader, op.Traceparent())
+	out.Header.Set(requestIDHeader, op.TelemetryID())
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(out)
+	TrackContext(req.Context(), t.client, newHTTPDependencyTelemetry(req, op, resp, err, start))
+
+	return resp, err
+}
+
+func newHTTPDependencyTelemetry(req *http.Request, op Operation, resp *http.Response, err error, start time.Time) *appinsights.RemoteDependencyTelemetry {
+	name := fmt.Sprintf("%s %s", req.Method, req.URL.Path)
+	success := err == nil && resp.StatusCode < http.StatusBadRequest
+
+	t := appinsights.NewRemoteDependencyTelemetry(name, httpDependencyType, req.URL.Host, success)
+	t.Timestamp = start
+	t.Duration = time.Since(start)
+	t.Id = op.TelemetryID()
+	t.Data = req.URL.String()
+	if resp != nil {
+		t.ResultCode = strconv.Itoa(resp.StatusCode)
+	}
+
+	t.Tags.Operation().SetId(op.ID)
+	if op.ParentID != "" {
+		t.Tags.Operation().SetParentId(op.ParentID)
+	}
+	if op.Name != "" {
+		t.Tags.Operation().SetName(op.Name)
+	}
+
+	return t
+}
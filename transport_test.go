@@ -0,0 +1,79 @@
+package appink8s
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/assert"
+)
+
+type transport_mockRoundTripper struct {
+	request *http.Request
+	status  int
+	err     error
+}
+
+func (m *transport_mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.request = req
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &http.Response{
+		StatusCode: m.status,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func Test_That_Transport_Tracks_Dependency(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	rt := NewTransport(client, &transport_mockRoundTripper{status: 503})
+
+	_, err := rt.RoundTrip(httptest.NewRequest("GET", "http://payments.shop.svc.cluster.local:8080/charges?id=1", nil))
+
+	assert.NoError(t, err)
+	assert.Len(t, client.items, 1)
+	dep := client.items[0].(*appinsights.RemoteDependencyTelemetry)
+	assert.Equal(t, "GET /charges", dep.Name)
+	assert.Equal(t, "HTTP", dep.Type)
+	assert.Equal(t, "payments.shop.svc.cluster.local:8080", dep.Target)
+	assert.Equal(t, "http://payments.shop.svc.cluster.local:8080/charges?id=1", dep.Data)
+	assert.Equal(t, "503", dep.ResultCode)
+	assert.False(t, dep.Success)
+}
+
+func Test_That_Transport_Propagates_Operation_Of_Request_Context(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	base := &transport_mockRoundTripper{status: 200}
+	rt := NewTransport(client, base)
+	op := NewOperation("GET /orders")
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req = req.WithContext(WithOperation(context.Background(), op))
+	_, _ = rt.RoundTrip(req)
+
+	dep := client.items[0].(*appinsights.RemoteDependencyTelemetry)
+	assert.Equal(t, op.ID, dep.Tags.Operation().GetId())
+	assert.Equal(t, op.TelemetryID(), dep.Tags.Operation().GetParentId())
+	assert.Equal(t, dep.Id, base.request.Header.Get("Request-Id"))
+	assert.True(t, strings.HasPrefix(base.request.Header.Get("traceparent"), "00-"+op.ID+"-"))
+	assert.Empty(t, req.Header.Get("traceparent"))
+}
+
+func Test_That_Transport_Tracks_Failed_Requests(t *testing.T) {
+	client := &middleware_mockTelemetryClient{}
+	rt := NewTransport(client, &transport_mockRoundTripper{err: errors.New("connection refused")})
+
+	_, err := rt.RoundTrip(httptest.NewRequest("GET", "http://orders/", nil))
+
+	assert.Error(t, err)
+	dep := client.items[0].(*appinsights.RemoteDependencyTelemetry)
+	assert.False(t, dep.Success)
+	assert.Empty(t, dep.ResultCode)
+}